@@ -0,0 +1,87 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Values of the auth type setting
+const (
+	authBasic  = "basic"
+	authBearer = "bearer"
+)
+
+// AuthConfig holds the credentials sent with a site's requests. Secrets may
+// be given directly or, to keep them out of config.yaml, as the names of
+// environment variables holding them.
+type AuthConfig struct {
+	Type        string `yaml:"type"` // "basic" or "bearer"
+	Username    string `yaml:"username"`
+	UsernameEnv string `yaml:"username_env"`
+	Password    string `yaml:"password"`
+	PasswordEnv string `yaml:"password_env"`
+	Token       string `yaml:"token"`
+	TokenEnv    string `yaml:"token_env"`
+}
+
+// resolve reads the credentials referenced by environment variable names and
+// checks that the configured type has what it needs. Errors name the setting
+// but never include a credential.
+func (a *AuthConfig) resolve() error {
+	for _, ref := range []struct {
+		name  string
+		value *string
+	}{{a.UsernameEnv, &a.Username}, {a.PasswordEnv, &a.Password}, {a.TokenEnv, &a.Token}} {
+		if ref.name == "" {
+			continue
+		}
+		value, ok := os.LookupEnv(ref.name)
+		if !ok {
+			return fmt.Errorf("environment variable %s is not set", ref.name)
+		}
+		*ref.value = value
+	}
+
+	switch a.Type {
+	case authBasic:
+		if a.Username == "" {
+			return fmt.Errorf("basic auth needs a username")
+		}
+	case authBearer:
+		if a.Token == "" {
+			return fmt.Errorf("bearer auth needs a token")
+		}
+	default:
+		return fmt.Errorf("unknown auth type %q", a.Type)
+	}
+	return nil
+}
+
+// setAuth adds the site's credentials to req. They are only sent to the
+// hosts the site's feed is built from, that of url and of existing_rss_url or
+// json_api, never to article links or media hosted elsewhere.
+func setAuth(req *http.Request, siteConfig SiteConfig) {
+	if siteConfig.Auth == nil || !isSourceHost(req.URL.Host, siteConfig) {
+		return
+	}
+
+	switch siteConfig.Auth.Type {
+	case authBasic:
+		req.SetBasicAuth(siteConfig.Auth.Username, siteConfig.Auth.Password)
+	case authBearer:
+		req.Header.Set("Authorization", "Bearer "+siteConfig.Auth.Token)
+	}
+}
+
+// isSourceHost reports whether host serves one of the site's sources
+func isSourceHost(host string, siteConfig SiteConfig) bool {
+	for _, source := range append([]string{siteConfig.URL}, sourceURLs(siteConfig)...) {
+		if u, err := url.Parse(source); err == nil && strings.EqualFold(u.Host, host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSetAuth(t *testing.T) {
+	auth := &AuthConfig{Type: authBearer, Token: "secret"}
+	tests := []struct {
+		name       string
+		siteConfig SiteConfig
+		url        string
+		want       bool
+	}{
+		{
+			name:       "page host",
+			siteConfig: SiteConfig{URL: "https://example.com/news", Auth: auth},
+			url:        "https://example.com/news",
+			want:       true,
+		},
+		{
+			name:       "existing feed on another host",
+			siteConfig: SiteConfig{URL: "https://example.com/news", ExistingRSSURL: "https://feeds.example.net/rss", Auth: auth},
+			url:        "https://feeds.example.net/rss",
+			want:       true,
+		},
+		{
+			name:       "JSON API on another host",
+			siteConfig: SiteConfig{URL: "https://example.com/news", JSONAPI: &JSONAPIConfig{URL: "https://api.example.com/posts"}, Auth: auth},
+			url:        "https://api.example.com/posts?page=1",
+			want:       true,
+		},
+		{
+			name:       "article link elsewhere",
+			siteConfig: SiteConfig{URL: "https://example.com/news", ExistingRSSURL: "https://feeds.example.net/rss", Auth: auth},
+			url:        "https://cdn.example.org/article",
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setAuth(req, tt.siteConfig)
+			if got := req.Header.Get("Authorization") != ""; got != tt.want {
+				t.Errorf("credentials sent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
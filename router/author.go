@@ -0,0 +1,36 @@
+package router
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// authorMetaSelectors are the meta tags naming the author of a whole page
+var authorMetaSelectors = []string{`meta[name="author"]`, `meta[property="article:author"]`}
+
+// findAuthor looks for the author within sel: the text of author_selector,
+// then a rel="author" link. With page set, sel is a whole article page and
+// its author meta tags are tried last; on index pages they would name the
+// author of the listing rather than of each article.
+func findAuthor(sel *goquery.Selection, siteConfig SiteConfig, page bool) string {
+	if len(siteConfig.AuthorSelector) > 0 {
+		if author := strings.TrimSpace(siteConfig.AuthorSelector.find(sel, siteConfig, "author", hasText).First().Text()); author != "" {
+			return author
+		}
+	}
+	if author := strings.TrimSpace(sel.Find(`a[rel~="author"]`).First().Text()); author != "" {
+		return author
+	}
+	if !page {
+		return ""
+	}
+	for _, selector := range authorMetaSelectors {
+		author := strings.TrimSpace(sel.Find(selector).AttrOr("content", ""))
+		// article:author often holds a profile URL rather than a name
+		if author != "" && !strings.HasPrefix(author, "http://") && !strings.HasPrefix(author, "https://") {
+			return author
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// cacheTTL is how long fetched pages and images are served from the cache
+	cacheTTL = 5 * time.Minute
+	// cacheShards spreads the entries over independently locked maps, so
+	// concurrent requests for different URLs rarely wait on each other
+	cacheShards = 16
+)
+
+// errFetchCancelled is returned to callers sharing a fetch whose initiating
+// request was cancelled, so they can fetch with their own context instead
+var errFetchCancelled = errors.New("shared fetch was cancelled")
+
+type cacheEntry struct {
+	content     []byte
+	contentType string // Only set for images, which unlike pages are served as fetched
+	expiry      time.Time
+	site        string // Site that fetched the URL
+	fetched     time.Time
+}
+
+type cacheShard struct {
+	sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+// pageCache holds fetched content by cache key. Concurrent misses for the
+// same key share a single upstream fetch.
+type pageCache struct {
+	shards   [cacheShards]cacheShard
+	inflight singleflight.Group
+}
+
+func newPageCache() *pageCache {
+	c := &pageCache{}
+	for i := range c.shards {
+		c.shards[i].entries = make(map[string]cacheEntry)
+	}
+	return c
+}
+
+func (c *pageCache) shard(key string) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &c.shards[h.Sum32()%cacheShards]
+}
+
+// get returns the entry for key unless it is missing or expired
+func (c *pageCache) get(key string) (cacheEntry, bool) {
+	entry, ok := c.lookup(key)
+	if !ok || !time.Now().Before(entry.expiry) {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// lookup returns the entry for key, expired or not
+func (c *pageCache) lookup(key string) (cacheEntry, bool) {
+	s := c.shard(key)
+	s.RLock()
+	defer s.RUnlock()
+	entry, ok := s.entries[key]
+	return entry, ok
+}
+
+// set stores content fetched for site under key
+func (c *pageCache) set(key, site string, content []byte, contentType string) {
+	now := time.Now()
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	s.entries[key] = cacheEntry{
+		content:     content,
+		contentType: contentType,
+		expiry:      now.Add(cacheTTL),
+		site:        site,
+		fetched:     now,
+	}
+}
+
+// invalidate removes every entry for which match returns true and reports
+// how many were dropped
+func (c *pageCache) invalidate(match func(url, site string) bool) int {
+	removed := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.Lock()
+		for key, entry := range s.entries {
+			if match(key, entry.site) {
+				delete(s.entries, key)
+				removed++
+			}
+		}
+		s.Unlock()
+	}
+	return removed
+}
+
+// load calls fetch and caches its result under key. Concurrent loads of the
+// same key share the first one's fetch. When the request that started the
+// shared fetch is cancelled, the others fetch again with their own context.
+func (c *pageCache) load(ctx context.Context, key, site string, fetch func() ([]byte, string, error)) (cacheEntry, error) {
+	for {
+		v, err, _ := c.inflight.Do(key, func() (interface{}, error) {
+			content, contentType, err := fetch()
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, errFetchCancelled
+				}
+				return nil, err
+			}
+			c.set(key, site, content, contentType)
+			entry, _ := c.lookup(key)
+			return entry, nil
+		})
+		if err != errFetchCancelled {
+			if err != nil {
+				return cacheEntry{}, err
+			}
+			return v.(cacheEntry), nil
+		}
+		if ctx.Err() != nil {
+			return cacheEntry{}, ctx.Err()
+		}
+	}
+}
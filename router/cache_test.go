@@ -0,0 +1,83 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const concurrentRequests = 50
+
+// countingServer serves a page slowly enough for concurrent requests to
+// overlap, counting the requests it receives
+func countingServer(t testing.TB) (*httptest.Server, *atomic.Int64) {
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("<html><body>page</body></html>"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+// fetchConcurrently requests url from concurrentRequests goroutines at once
+func fetchConcurrently(t testing.TB, rt *Router, url string) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, concurrentRequests)
+	for i := 0; i < concurrentRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if _, err := rt.fetchURLContent(context.Background(), "test", url, newRetryBudget(0)); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("fetchURLContent() error = %v", err)
+	}
+}
+
+func TestFetchURLContentCoalesces(t *testing.T) {
+	srv, hits := countingServer(t)
+	rt, _ := testRouter(t, SiteConfig{URL: srv.URL}, srv.Client())
+
+	fetchConcurrently(t, rt, srv.URL+"/page")
+	if got := hits.Load(); got != 1 {
+		t.Errorf("%d concurrent requests for a cold URL made %d upstream fetches, want 1", concurrentRequests, got)
+	}
+
+	fetchConcurrently(t, rt, srv.URL+"/page")
+	if got := hits.Load(); got != 1 {
+		t.Errorf("requests for a cached URL made %d upstream fetches in total, want 1", got)
+	}
+}
+
+// BenchmarkColdFetch requests a different cold URL from many goroutines at
+// once in each iteration, reporting the upstream fetches made per URL
+func BenchmarkColdFetch(b *testing.B) {
+	srv, hits := countingServer(b)
+	rt, _ := testRouter(b, SiteConfig{URL: srv.URL}, srv.Client())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fetchConcurrently(b, rt, fmt.Sprintf("%s/page?n=%d", srv.URL, i))
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(hits.Load())/float64(b.N), "fetches/url")
+	if got := hits.Load(); got != int64(b.N) {
+		b.Errorf("%d cold URLs fetched %d times, want one fetch each", b.N, got)
+	}
+}
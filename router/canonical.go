@@ -0,0 +1,59 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// canonicalGUIDs replaces the link-derived GUID of each item with the
+// canonical URL its article page declares with <link rel="canonical">, so an
+// article reached through different index links keeps one GUID. The pages
+// are fetched with fetchArticles, sharing the full content slots and
+// deadline; items whose page is not in by then, or declares no canonical
+// URL, keep their GUID. GUIDs read with guid_selector or guid_attr are left
+// alone.
+func (rt *Router) canonicalGUIDs(ctx context.Context, items []*Item, siteConfig SiteConfig, budget *retryBudget) {
+	outcomes, timedOut := fetchArticles(ctx, items, siteConfig, func(item *Item) (string, error) {
+		if item.Link == nil || item.Id != linkGUID(item.Link.Href, siteConfig) {
+			return "", nil
+		}
+		href, err := rt.canonicalURL(ctx, item.Link.Href, siteConfig, budget)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Error resolving canonical URL", "site", siteConfig.Name, "url", item.Link.Href, "error", err)
+		}
+		return href, err
+	})
+	if timedOut {
+		slog.Warn("Canonical URL deadline exceeded, keeping link GUIDs", "site", siteConfig.Name, "deadline", fullContentDeadline(siteConfig))
+	}
+
+	for i, item := range items {
+		if href := outcomes[i].value; outcomes[i].done && href != "" {
+			item.Id = href
+			// The canonical URL leads to the article as much as the link does
+			item.IsPermaLink = ""
+		}
+	}
+}
+
+// canonicalURL fetches an article page and returns the absolute canonical
+// URL it declares, or "" when it declares none
+func (rt *Router) canonicalURL(ctx context.Context, link string, siteConfig SiteConfig, budget *retryBudget) (string, error) {
+	body, err := rt.fetchURLContent(ctx, siteConfig.Name, link, budget)
+	if err != nil {
+		return "", err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	href := strings.TrimSpace(doc.Find(`link[rel="canonical"]`).First().AttrOr("href", ""))
+	if href == "" {
+		return "", nil
+	}
+	return absoluteURL(link, href), nil
+}
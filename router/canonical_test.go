@@ -0,0 +1,102 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// articleServer serves an index at / linking to articles /post/0 to
+// /post/<n-1>, each declaring /article/<i> as canonical URL. The index links
+// the first article twice, the second time with a tracking parameter. It
+// counts the article pages fetched and the most fetched at the same time.
+func articleServer(t *testing.T, n int) (srv *httptest.Server, fetched, peak *atomic.Int64) {
+	t.Helper()
+	var running atomic.Int64
+	fetched, peak = new(atomic.Int64), new(atomic.Int64)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if r.URL.Path == "/" || r.URL.Path == "" {
+			var b strings.Builder
+			b.WriteString("<html><body>")
+			for i := 0; i < n; i++ {
+				fmt.Fprintf(&b, `<article><h2><a href="/post/%d">Post %d</a></h2></article>`, i, i)
+			}
+			b.WriteString(`<article><h2><a href="/post/0?ref=home">Post 0 again</a></h2></article></body></html>`)
+			w.Write([]byte(b.String()))
+			return
+		}
+		fetched.Add(1)
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			max := peak.Load()
+			if now <= max || peak.CompareAndSwap(max, now) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprintf(w, `<html><head><link rel="canonical" href="/article/%s"></head><body><p>Body</p></body></html>`, strings.TrimPrefix(r.URL.Path, "/post/"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, fetched, peak
+}
+
+func TestCanonicalGUIDs(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxItems    int
+		wantGUIDs   []string // Relative to the server URL
+		wantFetched int64
+	}{
+		{
+			name:        "duplicate links merged",
+			wantGUIDs:   []string{"/article/0", "/article/1", "/article/2", "/article/3", "/article/4", "/article/5"},
+			wantFetched: 7,
+		},
+		{
+			name:        "only the items kept are fetched",
+			maxItems:    2,
+			wantGUIDs:   []string{"/article/0", "/article/1"},
+			wantFetched: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, fetched, peak := articleServer(t, 6)
+			rt, siteConfig := testRouter(t, SiteConfig{
+				URL:                srv.URL,
+				Title:              "Test",
+				TitleSelector:      Selectors{"h2"},
+				LinkSelector:       Selectors{"h2 a"},
+				ArticleSelector:    Selectors{"article"},
+				CanonicalGUID:      true,
+				FullContentFetches: 2,
+				MaxItems:           tt.maxItems,
+			}, srv.Client())
+
+			feed, err := rt.buildFeed(context.Background(), siteConfig, newRetryBudget(rt.config.RetryBudget))
+			if err != nil {
+				t.Fatalf("buildFeed() error = %v", err)
+			}
+			var guids []string
+			for _, item := range feed.Items {
+				guids = append(guids, strings.TrimPrefix(item.Id, srv.URL))
+			}
+			if strings.Join(guids, " ") != strings.Join(tt.wantGUIDs, " ") {
+				t.Errorf("item GUIDs = %q, want %q", guids, tt.wantGUIDs)
+			}
+			if got := fetched.Load(); got != tt.wantFetched {
+				t.Errorf("fetched %d article pages, want %d", got, tt.wantFetched)
+			}
+			if got := peak.Load(); got > 2 {
+				t.Errorf("fetched %d article pages at the same time, want at most full_content_fetches = 2", got)
+			}
+		})
+	}
+}
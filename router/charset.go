@@ -0,0 +1,41 @@
+package router
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log/slog"
+	"mime"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// htmlToUTF8 transcodes an HTML page to UTF-8, which goquery expects. The
+// encoding comes from the Content-Type header, then a <meta charset> in the
+// page. Other content types, and pages already in UTF-8, are returned as is.
+func htmlToUTF8(content []byte, contentType string) []byte {
+	if mediaType, _, err := mime.ParseMediaType(contentType); contentType != "" && (err != nil || mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return content
+	}
+
+	encoding, name, certain := charset.DetermineEncoding(content, contentType)
+	// Without a header or BOM the guess is only based on the first bytes, so
+	// a page that is valid UTF-8 throughout is kept as it is
+	if name == "utf-8" || !certain && utf8.Valid(content) {
+		return content
+	}
+	decoded, err := encoding.NewDecoder().Bytes(content)
+	if err != nil {
+		slog.Warn("Error transcoding page to UTF-8", "charset", name, "error", err)
+		return content
+	}
+	return decoded
+}
+
+// unmarshalXML parses an XML document such as a feed or sitemap, decoding it
+// from the encoding its XML declaration names, e.g. ISO-8859-1
+func unmarshalXML(content []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder.Decode(v)
+}
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHTMLToUTF8(t *testing.T) {
+	page, err := os.ReadFile("testdata/windows-1251.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutMeta := bytes.Replace(page, []byte(`<meta charset="windows-1251">`), nil, 1)
+	utf8Page := []byte(`<html><head><meta charset="utf-8"></head><body><h2>Привет, мир</h2></body></html>`)
+
+	tests := []struct {
+		name        string
+		content     []byte
+		contentType string
+		want        string
+	}{
+		{"charset in the header", withoutMeta, "text/html; charset=windows-1251", "Привет, мир"},
+		{"charset in meta only", page, "text/html", "Привет, мир"},
+		{"charset in meta without a header", page, "", "Привет, мир"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(htmlToUTF8(tt.content, tt.contentType))
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("htmlToUTF8() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("UTF-8 unchanged", func(t *testing.T) {
+		for _, contentType := range []string{"text/html; charset=utf-8", "text/html", ""} {
+			if got := htmlToUTF8(utf8Page, contentType); !bytes.Equal(got, utf8Page) {
+				t.Errorf("htmlToUTF8(%q) = %q, want the page unchanged", contentType, got)
+			}
+		}
+	})
+
+	t.Run("other content types unchanged", func(t *testing.T) {
+		if got := htmlToUTF8(page, "application/rss+xml"); !bytes.Equal(got, page) {
+			t.Errorf("htmlToUTF8() changed a feed")
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// clickURL returns the prefix tracked item links start with, given the
+// router's public base URL and the site they belong to
+func clickURL(baseURL, site string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/click?site=" + url.QueryEscape(site) + "&url="
+}
+
+// clickDomains returns the domains clicks of a site may redirect to: its
+// click_domains, or else the host of its page
+func clickDomains(siteConfig SiteConfig) []string {
+	if len(siteConfig.ClickDomains) > 0 {
+		return siteConfig.ClickDomains
+	}
+	u, err := url.Parse(siteConfig.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	return []string{u.Hostname()}
+}
+
+// trackClicks rewrites the link of each item to go through the /click
+// endpoint. GUIDs derived from the links keep the article URL.
+func trackClicks(feed *Feed, siteConfig SiteConfig) {
+	for _, item := range feed.Items {
+		if item.Link == nil || item.Link.Href == "" || strings.HasPrefix(item.Link.Href, siteConfig.clickURL) {
+			continue
+		}
+		item.Link.Href = siteConfig.clickURL + url.QueryEscape(item.Link.Href)
+	}
+}
+
+// clickHandler logs a click on an item of a site with track_clicks and
+// redirects to the article. Only URLs on the site's click domains are
+// redirected to, so the endpoint cannot be used as an open redirect.
+func (rt *Router) clickHandler(w http.ResponseWriter, r *http.Request) {
+	siteName := r.URL.Query().Get("site")
+	siteConfig, ok := rt.config.Sites[siteName]
+	if !ok || !siteConfig.TrackClicks {
+		http.Error(w, "Site not found in configuration", http.StatusNotFound)
+		return
+	}
+
+	target := r.URL.Query().Get("url")
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	if !allowedDomain(u.Hostname(), clickDomains(siteConfig)) {
+		http.Error(w, "URL host not allowed", http.StatusForbidden)
+		return
+	}
+
+	itemClicks.WithLabelValues(siteName).Inc()
+	slog.Info("Item clicked", "site", siteName, "url", target, "referer", r.Referer())
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
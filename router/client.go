@@ -0,0 +1,109 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+)
+
+// newTransport returns the transport for upstream requests. Without an
+// explicit proxy, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honored. With
+// forceHTTP1, HTTP/2 is never negotiated, even if a default would allow it.
+func newTransport(proxyURL *url.URL, forceHTTP1 bool) *http.Transport {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		Proxy:           http.ProxyFromEnvironment,
+	}
+	if proxyURL != nil {
+		tr.Proxy = http.ProxyURL(proxyURL)
+	}
+	if forceHTTP1 {
+		tr.ForceAttemptHTTP2 = false
+		// A non-nil empty map disables the transport's HTTP/2 support
+		tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return tr
+}
+
+// newClient returns an HTTP client with its own cookie jar, so cookies set by
+// upstreams (for example during a warm-up request) are sent back
+func newClient(proxyURL *url.URL, forceHTTP1 bool, timeout time.Duration) *http.Client {
+	jar, _ := cookiejar.New(nil) // New never fails without options
+	return &http.Client{Transport: newTransport(proxyURL, forceHTTP1), Jar: jar, Timeout: timeout}
+}
+
+// setupSiteClients builds the dedicated clients of sites with a proxy or
+// force_http1. Proxy URLs may use the http, https, socks5 or socks5h scheme.
+func (rt *Router) setupSiteClients() error {
+	rt.siteClients = make(map[string]*http.Client)
+	for name, siteConfig := range rt.config.Sites {
+		if siteConfig.Proxy == "" && !siteConfig.ForceHTTP1 {
+			continue
+		}
+
+		var proxyURL *url.URL
+		if siteConfig.Proxy != "" {
+			var err error
+			proxyURL, err = url.Parse(siteConfig.Proxy)
+			if err != nil {
+				return fmt.Errorf("invalid proxy for site %s: %v", name, err)
+			}
+			switch proxyURL.Scheme {
+			case "http", "https", "socks5", "socks5h":
+			default:
+				return fmt.Errorf("unsupported proxy scheme %q for site %s", proxyURL.Scheme, name)
+			}
+		}
+
+		rt.siteClients[name] = newClient(proxyURL, siteConfig.ForceHTTP1, rt.config.FetchTimeout)
+	}
+	return nil
+}
+
+// clientFor returns the HTTP client to use for requests made for site
+func (rt *Router) clientFor(site string) *http.Client {
+	if c, ok := rt.siteClients[site]; ok {
+		return c
+	}
+	return rt.client
+}
+
+// warmUp requests the site's warmup_url before its first real fetch, so that
+// anti-bot cookies are in the jar. It does nothing while the jar already
+// holds cookies for target.
+func (rt *Router) warmUp(ctx context.Context, site, target string) {
+	warmupURL := rt.config.Sites[site].WarmupURL
+	if warmupURL == "" || warmupURL == target {
+		return
+	}
+	c := rt.clientFor(site)
+	if u, err := url.Parse(target); err != nil || c.Jar == nil || len(c.Jar.Cookies(u)) > 0 {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, warmupURL, nil)
+	if err != nil {
+		slog.Warn("Invalid warm-up URL", "site", site, "url", warmupURL, "error", err)
+		return
+	}
+	setAuth(req, rt.config.Sites[site])
+	rt.setUserAgent(req, site)
+
+	if err := rt.waitForRateLimit(ctx, warmupURL); err != nil {
+		slog.Warn("Skipping warm-up request", "site", site, "url", warmupURL, "error", err)
+		return
+	}
+	slog.Debug("Warming up", "site", site, "url", warmupURL)
+	resp, err := c.Do(req)
+	if err != nil {
+		slog.Warn("Warm-up request failed", "site", site, "url", warmupURL, "error", err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
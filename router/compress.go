@@ -0,0 +1,100 @@
+package router
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultGzipLevel favours speed over size without giving up much compression
+const defaultGzipLevel = 6
+
+// gzipHandler compresses the responses of h for clients that accept gzip.
+// Validators such as ETag are computed by h on the uncompressed body, so they
+// stay the same whichever encoding the client receives.
+func gzipHandler(h http.HandlerFunc, level int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			h(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, level: level}
+		defer gw.Close()
+		h(gw, r)
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter compresses the body once the status is known to carry
+// one, so 304 responses are passed through untouched
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	level       int
+	wroteHeader bool
+	passthrough bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status == http.StatusNotModified || status == http.StatusNoContent {
+		w.passthrough = true
+	} else {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.gz == nil {
+		// The level is validated at startup, so this cannot fail
+		w.gz, _ = gzip.NewWriterLevel(w.ResponseWriter, w.level)
+	}
+	return w.gz.Write(b)
+}
+
+// Flush pushes compressed data written so far to the client
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) Close() error {
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// fullContentResult is the outcome of fetching an item's article page
+type fullContentResult struct {
+	Fetched       bool   `json:"fetched"`
+	Status        int    `json:"status,omitempty"` // HTTP status of the article page, unknown when cached
+	Cached        bool   `json:"cached,omitempty"`
+	ContentLength int    `json:"content_length"` // Length of the extracted HTML
+	Error         string `json:"error,omitempty"`
+}
+
+// fetchStatus is what is known about the last fetch of a URL
+type fetchStatus struct {
+	status int
+	cached bool
+}
+
+// fetchRecorder collects the status of the upstream fetches made for one
+// debug request
+type fetchRecorder struct {
+	sync.Mutex
+	byURL map[string]fetchStatus
+}
+
+type fetchRecorderKey struct{}
+
+// withFetchRecorder returns a context whose fetches are recorded
+func withFetchRecorder(ctx context.Context) (context.Context, *fetchRecorder) {
+	recorder := &fetchRecorder{byURL: make(map[string]fetchStatus)}
+	return context.WithValue(ctx, fetchRecorderKey{}, recorder), recorder
+}
+
+// recordFetch notes the response status of url, or that it was served from
+// the cache, when ctx belongs to a debug request
+func recordFetch(ctx context.Context, url string, status int, cached bool) {
+	recorder, ok := ctx.Value(fetchRecorderKey{}).(*fetchRecorder)
+	if !ok {
+		return
+	}
+	recorder.Lock()
+	recorder.byURL[url] = fetchStatus{status: status, cached: cached}
+	recorder.Unlock()
+}
+
+type debugItem struct {
+	Title       string             `json:"title"`
+	Link        string             `json:"link"`
+	FullContent *fullContentResult `json:"full_content,omitempty"`
+}
+
+// debugHandler builds a site's feed and reports each item with, for sites
+// with full_content_selector, whether its article page was fetched, the
+// page's HTTP status and the length of the extracted content
+func (rt *Router) debugHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	siteName := r.URL.Query().Get("site")
+	siteConfig, ok := rt.config.Sites[siteName]
+	if !ok {
+		http.Error(w, "Site not found in configuration", http.StatusNotFound)
+		return
+	}
+	if isPassthrough(siteConfig) {
+		http.Error(w, "Debug output is not available for sites whose feed is passed through", http.StatusBadRequest)
+		return
+	}
+
+	ctx, recorder := withFetchRecorder(r.Context())
+	feed, err := rt.buildSiteFeed(ctx, siteConfig, newRetryBudget(rt.config.RetryBudget))
+	if err != nil {
+		http.Error(w, "Failed to generate RSS: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recorder.Lock()
+	items := make([]debugItem, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		entry := debugItem{Title: item.Title, Link: item.Link.Href, FullContent: item.FullContent}
+		if entry.FullContent != nil {
+			fetch := recorder.byURL[entry.Link]
+			entry.FullContent.Status, entry.FullContent.Cached = fetch.status, fetch.cached
+		}
+		items = append(items, entry)
+	}
+	recorder.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"site": siteName, "items": items})
+}
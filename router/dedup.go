@@ -0,0 +1,53 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Values of dedup_hash
+const (
+	dedupTitleLink    = "title_link"
+	dedupTitleContent = "title_content"
+)
+
+const defaultDedupContentChars = 200
+
+// contentHash identifies an item by what it shows rather than by its GUID,
+// for sites that list one article under several URLs. Text is compared
+// case-insensitively with whitespace collapsed.
+func contentHash(item *Item, siteConfig SiteConfig) string {
+	h := sha256.New()
+	h.Write([]byte(normalizeText(item.Title)))
+	h.Write([]byte{0})
+	switch siteConfig.DedupHash {
+	case dedupTitleLink:
+		if item.Link != nil {
+			h.Write([]byte(cacheKey(item.Link.Href)))
+		}
+	case dedupTitleContent:
+		text := item.Description
+		if doc, err := goquery.NewDocumentFromReader(strings.NewReader(item.Description)); err == nil {
+			text = doc.Text()
+		}
+		h.Write([]byte(truncateRunes(normalizeText(text), siteConfig.DedupContentChars)))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeText lowercases s and collapses its whitespace
+func normalizeText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// truncateRunes returns the first n characters of s
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,118 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// xmlNamePart matches a namespace prefix or local element name
+var xmlNamePart = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9._-]*$`)
+
+// reservedPrefixes are declared by the RSS encoder itself, atom for the
+// pagination links and dc for detected languages
+var reservedPrefixes = map[string]bool{"xml": true, "xmlns": true, "content": true, "media": true, "atom": true, "dc": true}
+
+// itemElement is a publisher-specific element added to an item, such as
+// <myns:score>
+type itemElement struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// validateItemAttributes checks that every element named in item_attributes
+// is a prefixed name whose prefix is declared in namespaces
+func validateItemAttributes(siteConfig SiteConfig) error {
+	for prefix, uri := range siteConfig.Namespaces {
+		if !xmlNamePart.MatchString(prefix) {
+			return fmt.Errorf("invalid namespace prefix %q", prefix)
+		}
+		if reservedPrefixes[prefix] {
+			return fmt.Errorf("namespace prefix %q is reserved", prefix)
+		}
+		if uri == "" {
+			return fmt.Errorf("namespace %q has no URI", prefix)
+		}
+	}
+	for attr, element := range siteConfig.ItemAttributes {
+		if err := validateElement(element, siteConfig); err != nil {
+			return fmt.Errorf("%v for attribute %s", err, attr)
+		}
+	}
+	return nil
+}
+
+// validateElement checks that element is a prefixed name whose prefix is
+// declared in namespaces
+func validateElement(element string, siteConfig SiteConfig) error {
+	prefix, local, ok := strings.Cut(element, ":")
+	if !ok || !xmlNamePart.MatchString(local) {
+		return fmt.Errorf("invalid element %q, expected prefix:name", element)
+	}
+	if _, declared := siteConfig.Namespaces[prefix]; !declared {
+		return fmt.Errorf("element %q uses undeclared namespace prefix %q", element, prefix)
+	}
+	return nil
+}
+
+// itemAttributes copies the configured attributes of the article element into
+// custom elements, ordered by attribute name. Missing or empty attributes are
+// left out.
+func itemAttributes(article *goquery.Selection, siteConfig SiteConfig) []itemElement {
+	if len(siteConfig.ItemAttributes) == 0 {
+		return nil
+	}
+	attrs := make([]string, 0, len(siteConfig.ItemAttributes))
+	for attr := range siteConfig.ItemAttributes {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+
+	var elements []itemElement
+	for _, attr := range attrs {
+		value := strings.TrimSpace(article.AttrOr(attr, ""))
+		if value == "" {
+			continue
+		}
+		elements = append(elements, itemElement{
+			XMLName: xml.Name{Local: siteConfig.ItemAttributes[attr]},
+			Value:   value,
+		})
+	}
+	return elements
+}
+
+// addChecksums adds the checksum_element to each item, holding the SHA-256
+// of its final content, so consumers can tell when an article changed while
+// its title and link stayed the same
+func addChecksums(items []*Item, siteConfig SiteConfig) {
+	for _, item := range items {
+		sum := sha256.Sum256([]byte(item.Description))
+		item.Elements = append(item.Elements, itemElement{
+			XMLName: xml.Name{Local: siteConfig.ChecksumElement},
+			Value:   hex.EncodeToString(sum[:]),
+		})
+	}
+}
+
+// namespaceAttrs returns the xmlns declarations of the custom namespaces,
+// ordered by prefix so the output is stable
+func namespaceAttrs(namespaces map[string]string) []xml.Attr {
+	prefixes := make([]string, 0, len(namespaces))
+	for prefix := range namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	attrs := make([]xml.Attr, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "xmlns:" + prefix}, Value: namespaces[prefix]})
+	}
+	return attrs
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/feeds"
+)
+
+func TestValidateItemAttributes(t *testing.T) {
+	tests := []struct {
+		name       string
+		siteConfig SiteConfig
+		wantErr    bool
+	}{
+		{
+			name:       "declared prefix",
+			siteConfig: SiteConfig{Namespaces: map[string]string{"myns": "urn:x"}, ItemAttributes: map[string]string{"data-score": "myns:score"}},
+		},
+		{
+			name:       "undeclared prefix",
+			siteConfig: SiteConfig{ItemAttributes: map[string]string{"data-score": "myns:score"}},
+			wantErr:    true,
+		},
+		{
+			name:       "element without prefix",
+			siteConfig: SiteConfig{Namespaces: map[string]string{"myns": "urn:x"}, ItemAttributes: map[string]string{"data-score": "score"}},
+			wantErr:    true,
+		},
+		{
+			name:       "atom redefined",
+			siteConfig: SiteConfig{Namespaces: map[string]string{"atom": "urn:x"}},
+			wantErr:    true,
+		},
+		{
+			name:       "dc redefined",
+			siteConfig: SiteConfig{Namespaces: map[string]string{"dc": "urn:x"}},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateItemAttributes(tt.siteConfig); (err != nil) != tt.wantErr {
+				t.Errorf("validateItemAttributes() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestWriteRSSNamespaces checks that custom namespaces, pagination links and
+// detected languages together still make well-formed XML
+func TestWriteRSSNamespaces(t *testing.T) {
+	feed := &Feed{
+		Feed: &feeds.Feed{Title: "Test", Link: &feeds.Link{Href: "https://example.com/"}},
+		Items: []*Item{{
+			Item:     &feeds.Item{Title: "One", Link: &feeds.Link{Href: "https://example.com/one"}, Id: "https://example.com/one"},
+			Language: "en",
+			Elements: []itemElement{{XMLName: xml.Name{Local: "myns:score"}, Value: "5"}},
+		}},
+		Namespaces: map[string]string{"myns": "urn:x"},
+		Next:       "https://feeds.example.com/generate_rss?site=test&page=2",
+	}
+	out, err := renderRSS(feed)
+	if err != nil {
+		t.Fatalf("renderRSS() error = %v", err)
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(out))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("output is not well-formed: %v\n%s", err, out)
+		}
+	}
+	for _, want := range []string{`xmlns:atom="http://www.w3.org/2005/Atom"`, `xmlns:dc="` + dcNamespace + `"`, `xmlns:myns="urn:x"`, `<myns:score>5</myns:score>`} {
+		if strings.Count(out, want) != 1 {
+			t.Errorf("output has %d occurrences of %s, want 1", strings.Count(out, want), want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// isFileURL reports whether rawURL names a local file
+func isFileURL(rawURL string) bool {
+	return strings.HasPrefix(strings.ToLower(rawURL), "file://")
+}
+
+// fetchFile reads a file:// source of a site. Only the URLs the site's feed
+// is built from are read, never file:// links found in them, so a page
+// cannot make the router publish local files. The modification time of the
+// file is kept for file_dates.
+func (rt *Router) fetchFile(ctx context.Context, site, rawURL string) ([]byte, failureKind, error) {
+	if !slices.Contains(sourceURLs(rt.config.Sites[site]), rawURL) {
+		return nil, failurePermanent, fmt.Errorf("file URLs are only read as a site's source: %s", rawURL)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, failurePermanent, fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, failurePermanent, fmt.Errorf("file URL names a remote host: %s", rawURL)
+	}
+
+	slog.Debug("Reading file", "site", site, "path", u.Path)
+	info, err := os.Stat(u.Path)
+	if err != nil {
+		return nil, failurePermanent, fmt.Errorf("failed to read the file: %v", err)
+	}
+	content, err := os.ReadFile(u.Path)
+	if err != nil {
+		return nil, failurePermanent, fmt.Errorf("failed to read the file: %v", err)
+	}
+	recordFetch(ctx, rawURL, 0, false)
+
+	rt.files.Lock()
+	rt.files.modTimes[rawURL] = info.ModTime()
+	rt.files.Unlock()
+	// Only HTML files are transcoded, XML ones being decoded as their
+	// declaration says when parsed
+	mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(u.Path)))
+	return htmlToUTF8(content, mediaType), failurePermanent, nil
+}
+
+// fileModTime returns the modification time of a file:// source when it
+// was read
+func (rt *Router) fileModTime(rawURL string) (time.Time, bool) {
+	rt.files.Lock()
+	defer rt.files.Unlock()
+	modTime, ok := rt.files.modTimes[rawURL]
+	return modTime, ok
+}
+
+// fileDates dates the items without a date of their own with the
+// modification time of the site's file:// page
+func (rt *Router) fileDates(items []*Item, siteConfig SiteConfig) {
+	modTime, ok := rt.fileModTime(siteConfig.URL)
+	if !ok {
+		return
+	}
+	for _, item := range items {
+		if item.Created.IsZero() {
+			item.Created = modTime.UTC()
+		}
+	}
+}
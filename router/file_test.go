@@ -0,0 +1,55 @@
+package router
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	feedPath := filepath.Join(dir, "feed.xml")
+	// "Crème" in ISO-8859-1, the second item undated
+	feed := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0"><channel><title>Local</title>
+<item><title>Cr` + "\xe8" + `me</title><link>https://example.com/a</link><pubDate>Wed, 01 May 2024 10:00:00 +0000</pubDate></item>
+<item><title>Undated</title><link>https://example.com/b</link></item>
+</channel></rss>`
+	if err := os.WriteFile(feedPath, []byte(feed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+	if err := os.Chtimes(feedPath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, siteConfig := testRouter(t, SiteConfig{
+		URL:              "https://example.com/",
+		ExistingRSSURL:   "file://" + filepath.ToSlash(feedPath),
+		ParseExistingRSS: true,
+		FileDates:        true,
+	}, nil)
+	_, _, _, items, err := rt.existingFeedItems(context.Background(), siteConfig, newRetryBudget(rt.config.RetryBudget))
+	if err != nil {
+		t.Fatalf("existingFeedItems() error = %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	if items[0].Title != "Crème" {
+		t.Errorf("title = %q, want %q", items[0].Title, "Crème")
+	}
+	if want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC); !items[0].Created.Equal(want) {
+		t.Errorf("dated item created = %v, want %v", items[0].Created, want)
+	}
+	if !items[1].Created.Equal(modTime) {
+		t.Errorf("undated item created = %v, want the file's modification time %v", items[1].Created, modTime)
+	}
+
+	// Only the site's own sources are read from disk
+	if _, err := rt.fetchURLContent(context.Background(), "test", "file:///etc/hostname", newRetryBudget(0)); err == nil {
+		t.Error("fetching a file that is not a source succeeded, want an error")
+	}
+}
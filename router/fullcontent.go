@@ -0,0 +1,200 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gorilla/feeds"
+)
+
+const (
+	defaultFullContentDeadline = 20 * time.Second
+	defaultFullContentFetches  = 8
+)
+
+// articleFetch is the outcome of fetching the article page of one item
+type articleFetch[T any] struct {
+	value T
+	err   error
+	done  bool
+}
+
+// fetchArticles calls fetch for each item concurrently, at most
+// full_content_fetches at a time, and returns the outcomes by item once all
+// calls returned, the full content deadline passed or ctx is done. Items
+// whose call did not return in time are not done; timedOut tells the
+// deadline passed. Calls still running afterwards only warm the cache, until
+// the request ends and cancels them.
+func fetchArticles[T any](ctx context.Context, items []*Item, siteConfig SiteConfig, fetch func(item *Item) (T, error)) (outcomes []articleFetch[T], timedOut bool) {
+	fetches := siteConfig.FullContentFetches
+	if fetches <= 0 {
+		fetches = defaultFullContentFetches
+	}
+	slots := make(chan struct{}, fetches)
+
+	var mu sync.Mutex
+	results := make([]articleFetch[T], len(items))
+
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item *Item) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return
+			}
+			value, err := fetch(item)
+			mu.Lock()
+			results[i] = articleFetch[T]{value: value, err: err, done: err == nil}
+			mu.Unlock()
+		}(i, item)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(fullContentDeadline(siteConfig))
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		timedOut = true
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]articleFetch[T](nil), results...), timedOut
+}
+
+// fullContentDeadline is how long article pages are waited for, from
+// full_content_deadline
+func fullContentDeadline(siteConfig SiteConfig) time.Duration {
+	if siteConfig.FullContentDeadline > 0 {
+		return siteConfig.FullContentDeadline
+	}
+	return defaultFullContentDeadline
+}
+
+// fetchedArticle is what fetchFullContent reads from an article page
+type fetchedArticle struct {
+	content  string
+	metadata articleMetadata
+}
+
+// fetchFullContent replaces the description of each item with the content
+// of its linked article page, fetched with fetchArticles; items whose page
+// did not arrive in time keep the index page or feed content and are marked
+// as partial.
+func (rt *Router) fetchFullContent(ctx context.Context, items []*Item, siteConfig SiteConfig, budget *retryBudget) {
+	outcomes, timedOut := fetchArticles(ctx, items, siteConfig, func(item *Item) (fetchedArticle, error) {
+		content, meta, err := rt.articleContent(ctx, item.Link.Href, siteConfig, budget)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Error fetching full content", "site", siteConfig.Name, "url", item.Link.Href, "error", err)
+		}
+		return fetchedArticle{content: content, metadata: meta}, err
+	})
+	if timedOut {
+		slog.Warn("Full content deadline exceeded, serving partial content", "site", siteConfig.Name, "deadline", fullContentDeadline(siteConfig))
+	}
+
+	for i, item := range items {
+		outcome := outcomes[i]
+		item.FullContent = &fullContentResult{Fetched: outcome.done, ContentLength: len(outcome.value.content)}
+		if outcome.done {
+			item.Description = wrapHTML(outcome.value.content)
+			if item.Author == nil && outcome.value.metadata.author != "" {
+				item.Author = &feeds.Author{Name: outcome.value.metadata.author}
+			}
+			applyJSONLD(item, outcome.value.metadata.jsonLD, siteConfig)
+		} else {
+			item.Partial = true
+			item.Description += "\n<!-- Full content unavailable -->"
+			item.FullContent.Error = "not fetched before the deadline"
+			if outcome.err != nil {
+				item.FullContent.Error = outcome.err.Error()
+			}
+		}
+	}
+}
+
+// articleMetadata is what an article page tells about the article besides
+// its content
+type articleMetadata struct {
+	author string
+	jsonLD jsonLDArticle // Only read when use_jsonld is set
+}
+
+// articleContent fetches an article page and extracts its full content, along
+// with the page's author and JSON-LD metadata
+func (rt *Router) articleContent(ctx context.Context, link string, siteConfig SiteConfig, budget *retryBudget) (string, articleMetadata, error) {
+	var meta articleMetadata
+	body, err := rt.fetchURLContent(ctx, siteConfig.Name, link, budget)
+	if err != nil {
+		return "", meta, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return "", meta, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	contentTag := siteConfig.matchers.find(doc.Selection, siteConfig.FullContentSelector)
+	if siteConfig.PreferAMP {
+		if ampTag := rt.ampContent(ctx, doc, link, siteConfig, budget); ampTag != nil {
+			contentTag = ampTag
+		}
+	}
+	if contentTag.Length() == 0 {
+		return "", meta, fmt.Errorf("full content selector %q matched nothing", siteConfig.FullContentSelector)
+	}
+	meta.author = findAuthor(doc.Selection, siteConfig, true)
+	if siteConfig.UseJSONLD {
+		meta.jsonLD, _ = findJSONLD(doc.Selection)
+	}
+	return contentHTML(contentTag, siteConfig), meta, nil
+}
+
+// ampContent fetches the AMP version an article page links to with
+// <link rel="amphtml"> and returns its full content. It returns nil when the
+// page has no AMP version or the AMP page cannot be used, so the caller falls
+// back to the page itself.
+func (rt *Router) ampContent(ctx context.Context, doc *goquery.Document, link string, siteConfig SiteConfig, budget *retryBudget) *goquery.Selection {
+	href := strings.TrimSpace(doc.Find(`link[rel="amphtml"]`).AttrOr("href", ""))
+	if href == "" {
+		return nil
+	}
+	ampURL := absoluteURL(link, href)
+
+	body, err := rt.fetchURLContent(ctx, siteConfig.Name, ampURL, budget)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("Error fetching AMP page, using the article page", "site", siteConfig.Name, "url", ampURL, "error", err)
+		}
+		return nil
+	}
+	ampDoc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("Error parsing AMP page, using the article page", "site", siteConfig.Name, "url", ampURL, "error", err)
+		return nil
+	}
+
+	contentTag := siteConfig.matchers.find(ampDoc.Selection, siteConfig.FullContentSelector)
+	if contentTag.Length() == 0 {
+		slog.Debug("Full content selector matched nothing on AMP page", "site", siteConfig.Name, "url", ampURL)
+		return nil
+	}
+	return contentTag
+}
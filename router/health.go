@@ -0,0 +1,99 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReadinessCheckTTL = 30 * time.Second
+	readinessProbeTimeout    = 5 * time.Second
+)
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler reports ready once the router is set up and, with
+// readiness_check enabled, at least one configured site is reachable
+func (rt *Router) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.config.ReadinessCheck {
+		fmt.Fprintln(w, "ready")
+		return
+	}
+
+	ready, report := rt.checkSites()
+	if !ready {
+		http.Error(w, report, http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, report)
+}
+
+// checkSites probes every configured site, reusing the previous result while
+// it is younger than readiness_check_ttl. Concurrent callers share one check.
+func (rt *Router) checkSites() (bool, string) {
+	rt.readiness.Lock()
+	defer rt.readiness.Unlock()
+
+	if time.Since(rt.readiness.checked) < rt.config.ReadinessCheckTTL {
+		return rt.readiness.ready, rt.readiness.report
+	}
+
+	var mu sync.Mutex
+	var lines []string
+	ready := len(rt.config.Sites) == 0
+
+	var wg sync.WaitGroup
+	for name, siteConfig := range rt.config.Sites {
+		target := siteConfig.URL
+		if siteConfig.ExistingRSSURL != "" {
+			target = siteConfig.ExistingRSSURL
+		}
+
+		wg.Add(1)
+		go func(name, target string) {
+			defer wg.Done()
+			err := rt.probe(name, target)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lines = append(lines, fmt.Sprintf("%s: unreachable: %v", name, err))
+				return
+			}
+			ready = true
+			lines = append(lines, fmt.Sprintf("%s: ok", name))
+		}(name, target)
+	}
+	wg.Wait()
+
+	sort.Strings(lines)
+	rt.readiness.checked = time.Now()
+	rt.readiness.ready = ready
+	rt.readiness.report = strings.Join(lines, "\n") + "\n"
+	return rt.readiness.ready, rt.readiness.report
+}
+
+// probe checks that target answers at all; any HTTP status counts as reachable
+func (rt *Router) probe(site, target string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), readinessProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+	if err != nil {
+		return err
+	}
+	rt.setUserAgent(req, site)
+	resp, err := rt.clientFor(site).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
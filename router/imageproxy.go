@@ -0,0 +1,158 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxImageSize bounds the images the /image endpoint fetches and caches
+const maxImageSize = 10 << 20
+
+// imageProxyURL returns the prefix proxied image URLs start with, given the
+// router's public base URL
+func imageProxyURL(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/image?url="
+}
+
+// proxyImage rewrites src to go through the /image endpoint when the site
+// has proxy_images set and the image is served from one of its image_hosts.
+// Images from other hosts are left alone, as the endpoint would refuse them.
+func proxyImage(src string, siteConfig SiteConfig) string {
+	if siteConfig.imageProxy == "" || !isImageHost(src, siteConfig) {
+		return src
+	}
+	return siteConfig.imageProxy + url.QueryEscape(src)
+}
+
+// imageHosts returns the domains a site's images may be proxied from: its
+// image_hosts, or else the host of its page
+func imageHosts(siteConfig SiteConfig) []string {
+	if len(siteConfig.ImageHosts) > 0 {
+		return siteConfig.ImageHosts
+	}
+	u, err := url.Parse(siteConfig.URL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	return []string{u.Hostname()}
+}
+
+// isImageHost reports whether the absolute URL src is on one of the site's
+// image_hosts or a subdomain of one
+func isImageHost(src string, siteConfig SiteConfig) bool {
+	u, err := url.Parse(src)
+	return err == nil && u.Hostname() != "" && allowedDomain(u.Hostname(), imageHosts(siteConfig))
+}
+
+// imageSite returns the site with proxy_images whose image_hosts serve the
+// image, so the endpoint cannot be used as an open proxy
+func (rt *Router) imageSite(imageURL string) (string, bool) {
+	for name, siteConfig := range rt.config.Sites {
+		if siteConfig.ProxyImages && isImageHost(imageURL, siteConfig) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (rt *Router) imageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	imageURL := r.URL.Query().Get("url")
+	u, err := url.Parse(imageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		http.Error(w, "Invalid image URL", http.StatusBadRequest)
+		return
+	}
+	site, ok := rt.imageSite(imageURL)
+	if !ok {
+		http.Error(w, "Image host not allowed", http.StatusForbidden)
+		return
+	}
+
+	content, contentType, err := rt.fetchImage(r.Context(), site, imageURL)
+	if err != nil {
+		slog.Warn("Error proxying image", "site", site, "url", imageURL, "error", err)
+		http.Error(w, "Failed to fetch image", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+}
+
+// fetchImage returns an image and its content type, from the cache when
+// possible. The request carries the site's credentials and its URL as
+// referer, for sites that refuse hotlinked images.
+func (rt *Router) fetchImage(ctx context.Context, site, imageURL string) ([]byte, string, error) {
+	key := cacheKey(imageURL)
+	if entry, ok := rt.cache.get(key); ok && entry.contentType != "" {
+		cacheRequests.WithLabelValues(site, "hit").Inc()
+		return entry.content, entry.contentType, nil
+	}
+	cacheRequests.WithLabelValues(site, "miss").Inc()
+
+	entry, err := rt.cache.load(ctx, key, site, func() ([]byte, string, error) {
+		return rt.fetchImageOnce(ctx, site, imageURL)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	// A page fetch of the same URL may have been shared
+	if entry.contentType == "" {
+		return nil, "", fmt.Errorf("%s is not an image", imageURL)
+	}
+	return entry.content, entry.contentType, nil
+}
+
+// fetchImageOnce performs the upstream request for an image
+func (rt *Router) fetchImageOnce(ctx context.Context, site, imageURL string) ([]byte, string, error) {
+	if err := rt.waitForRateLimit(ctx, imageURL); err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid URL: %v", err)
+	}
+	siteConfig := rt.config.Sites[site]
+	req.Header.Set("Referer", siteConfig.URL)
+	setAuth(req, siteConfig)
+	rt.setUserAgent(req, site)
+
+	resp, err := rt.clientFor(site).Do(req)
+	if err != nil {
+		upstreamErrors.WithLabelValues(site).Inc()
+		return nil, "", fmt.Errorf("failed to fetch the image: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		upstreamErrors.WithLabelValues(site).Inc()
+		return nil, "", fmt.Errorf("server returned %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read response body: %v", err)
+	}
+	if len(content) > maxImageSize {
+		return nil, "", fmt.Errorf("image exceeds %d bytes", maxImageSize)
+	}
+	return content, contentType, nil
+}
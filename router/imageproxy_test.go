@@ -0,0 +1,80 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxyImage(t *testing.T) {
+	const proxy = "https://feeds.example.org/image?url="
+	tests := []struct {
+		name       string
+		imageHosts []string
+		src        string
+		wantProxy  bool
+	}{
+		{"site host by default", nil, "https://www.example.com/a.jpg", true},
+		{"other host by default", nil, "https://cdn.example.net/a.jpg", false},
+		{"listed CDN", []string{"img.example.com", "cdn.example.net"}, "https://cdn.example.net/a.jpg", true},
+		{"subdomain of a listed host", []string{"example.net"}, "https://static.example.net/a.jpg", true},
+		{"unlisted host", []string{"cdn.example.net"}, "https://tracker.example.org/a.jpg", false},
+		{"relative source", nil, "/a.jpg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			siteConfig := SiteConfig{URL: "https://www.example.com/blog", ProxyImages: true, ImageHosts: tt.imageHosts, imageProxy: proxy}
+			want := tt.src
+			if tt.wantProxy {
+				want = proxy + url.QueryEscape(tt.src)
+			}
+			if got := proxyImage(tt.src, siteConfig); got != want {
+				t.Errorf("proxyImage(%q) = %q, want %q", tt.src, got, want)
+			}
+		})
+	}
+}
+
+func TestImageHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer srv.Close()
+
+	// The images live on another host than the site's pages
+	rt, err := New(Config{
+		BaseURL: "https://feeds.example.org",
+		Sites: map[string]SiteConfig{"test": {
+			URL:         "https://www.example.com/",
+			ProxyImages: true,
+			ImageHosts:  []string{"127.0.0.1"},
+		}},
+	}, srv.Client())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		imageURL   string
+		wantStatus int
+	}{
+		{"image host", srv.URL + "/a.png", http.StatusOK},
+		{"site host not listed", "https://www.example.com/a.png", http.StatusForbidden},
+		{"other host", "https://example.net/a.png", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rt.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/image?url="+url.QueryEscape(tt.imageURL), nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && rec.Body.String() != "png" {
+				t.Errorf("body = %q, want %q", rec.Body, "png")
+			}
+		})
+	}
+}
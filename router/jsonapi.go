@@ -0,0 +1,147 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gorilla/feeds"
+)
+
+// JSONAPIConfig points a site at the JSON API its listing is loaded from.
+// Fields are dotted paths into the response, such as "data.posts" or
+// "attributes.title"; numeric parts index into arrays.
+type JSONAPIConfig struct {
+	URL     string `yaml:"url"`
+	Items   string `yaml:"items"` // Path of the array of articles, empty when the response is the array
+	Title   string `yaml:"title"`
+	Link    string `yaml:"link"`
+	Date    string `yaml:"date"` // Parsed with date_format, or as RFC 3339 or a Unix timestamp when unset
+	Content string `yaml:"content"`
+	GUID    string `yaml:"guid"`
+}
+
+// buildFeedFromJSON fetches the site's JSON API and maps its articles to
+// items, which then go through the same processing as scraped articles
+func (rt *Router) buildFeedFromJSON(ctx context.Context, siteConfig SiteConfig, budget *retryBudget) (*Feed, error) {
+	api := siteConfig.JSONAPI
+	content, err := rt.fetchURLContent(ctx, siteConfig.Name, api.URL, budget)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the JSON API: %v", err)
+	}
+
+	var response interface{}
+	if err := json.Unmarshal(content, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	articles, ok := jsonPath(response, api.Items).([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("JSON path %q is not an array", api.Items)
+	}
+	slog.Debug("Found articles", "site", siteConfig.Name, "count", len(articles))
+
+	fetched := rt.fetchedAt(api.URL)
+	var items []*Item
+	for _, article := range articles {
+		items = append(items, jsonItem(article, siteConfig, fetched))
+	}
+	return rt.newFeed(ctx, siteConfig.Title, siteConfig.URL, siteConfig.Description, items, siteConfig, budget), nil
+}
+
+func jsonItem(article interface{}, siteConfig SiteConfig, fetched time.Time) *Item {
+	api := siteConfig.JSONAPI
+	link := jsonString(article, api.Link)
+	if link != "" {
+		link = itemLink(absoluteURL(siteConfig.URL, link), siteConfig)
+	}
+
+	description := "No description available"
+	if body := jsonString(article, api.Content); body != "" {
+		if doc, err := goquery.NewDocumentFromReader(strings.NewReader(body)); err == nil {
+			description = contentHTML(doc.Find("body"), siteConfig)
+		}
+	}
+
+	guid := jsonString(article, api.GUID)
+	isPermaLink := ""
+	if guid == "" {
+		guid = linkGUID(link, siteConfig)
+	}
+	if guid != link {
+		isPermaLink = "false"
+	}
+
+	return &Item{
+		Item: &feeds.Item{
+			Title:       jsonString(article, api.Title),
+			Link:        &feeds.Link{Href: link},
+			Description: wrapHTML(description),
+			Created:     jsonDate(jsonPath(article, api.Date), siteConfig, fetched),
+			Id:          guid,
+			IsPermaLink: isPermaLink,
+		},
+	}
+}
+
+// jsonPath follows a dotted path through decoded JSON, returning nil when a
+// part of it does not exist
+func jsonPath(v interface{}, path string) interface{} {
+	if path == "" {
+		return v
+	}
+	for _, part := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[part]
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// jsonString returns the value at path as a string, or "" when the path is
+// unset or leads to an object or array
+func jsonString(v interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+	switch value := jsonPath(v, path).(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return ""
+}
+
+// jsonDate parses a date from the API: a string in date_format or RFC 3339,
+// or a number of seconds (or milliseconds) since the Unix epoch
+func jsonDate(v interface{}, siteConfig SiteConfig, fetched time.Time) time.Time {
+	switch value := v.(type) {
+	case float64:
+		if value > 1e12 {
+			return time.UnixMilli(int64(value)).UTC()
+		}
+		return time.Unix(int64(value), 0).UTC()
+	case string:
+		if siteConfig.DateFormat != "" || siteConfig.DateParseMode != "" {
+			return parseDate(value, siteConfig, fetched)
+		}
+		return parseTime(strings.TrimSpace(value), time.RFC3339, siteConfig.location)
+	}
+	return fetched.UTC()
+}
@@ -0,0 +1,69 @@
+package router
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gorilla/feeds"
+)
+
+// Values of the format query parameter
+const (
+	formatRSS  = "rss"
+	formatJSON = "json"
+)
+
+// renderJSONFeed returns the feed as a JSON Feed document
+func renderJSONFeed(feed *Feed) (string, error) {
+	channel := *feed.Feed
+	channel.Items = make([]*feeds.Item, len(feed.Items))
+	for i, item := range feed.Items {
+		channel.Items[i] = item.Item
+	}
+
+	jsonFeed := (&feeds.JSON{Feed: &channel}).JSONFeed()
+	jsonFeed.Icon = feed.Icon
+	jsonFeed.Favicon = feed.Favicon
+	jsonFeed.NextUrl = feed.Next
+	for i, item := range feed.Items {
+		jsonItem := jsonFeed.Items[i]
+		// Descriptions are the article's HTML, not a plain-text summary
+		if jsonItem.ContentHTML == "" {
+			jsonItem.ContentHTML, jsonItem.Summary = jsonItem.Summary, ""
+		}
+		if item.Image != "" {
+			jsonItem.Image = item.Image
+		}
+		jsonItem.Tags = item.Categories
+	}
+
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(jsonFeed); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// discoverIcons fills in the icons the site does not configure from the
+// <link> tags of its page. The larger apple-touch-icon serves as icon, the
+// "icon" link as favicon, and each stands in for the other when missing.
+func discoverIcons(feed *Feed, doc *goquery.Document, siteConfig SiteConfig) {
+	linkHref := func(rels ...string) string {
+		for _, rel := range rels {
+			if href := strings.TrimSpace(doc.Find(`link[rel~="`+rel+`"][href]`).First().AttrOr("href", "")); href != "" {
+				return absoluteURL(siteConfig.URL, href)
+			}
+		}
+		return ""
+	}
+	if feed.Icon == "" {
+		feed.Icon = linkHref("apple-touch-icon", "icon")
+	}
+	if feed.Favicon == "" {
+		feed.Favicon = linkHref("icon", "apple-touch-icon")
+	}
+}
@@ -0,0 +1,146 @@
+package router
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gorilla/feeds"
+)
+
+// jsonLDDateLayouts are the ISO 8601 forms found in datePublished
+var jsonLDDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05", "2006-01-02"}
+
+// jsonLDArticle is the metadata read from an Article, NewsArticle or
+// BlogPosting JSON-LD block. Fields the block lacks are left empty.
+type jsonLDArticle struct {
+	Headline  string
+	Published time.Time
+	Author    string
+	Image     string
+}
+
+// findJSONLD returns the metadata of the first article block in the
+// application/ld+json scripts within sel, if any
+func findJSONLD(sel *goquery.Selection) (jsonLDArticle, bool) {
+	var found jsonLDArticle
+	ok := false
+	sel.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		var data interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &data); err != nil {
+			return true
+		}
+		if node := jsonLDArticleNode(data); node != nil {
+			found, ok = parseJSONLDArticle(node), true
+		}
+		return !ok
+	})
+	return found, ok
+}
+
+// jsonLDArticleNode searches a decoded block, including arrays and @graph
+// lists, for a node typed as an article
+func jsonLDArticleNode(data interface{}) map[string]interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, entry := range v {
+			if node := jsonLDArticleNode(entry); node != nil {
+				return node
+			}
+		}
+	case map[string]interface{}:
+		if isJSONLDArticleType(v["@type"]) {
+			return v
+		}
+		return jsonLDArticleNode(v["@graph"])
+	}
+	return nil
+}
+
+func isJSONLDArticleType(t interface{}) bool {
+	switch v := t.(type) {
+	case string:
+		return strings.HasSuffix(v, "Article") || v == "BlogPosting" || v == "Report"
+	case []interface{}:
+		for _, entry := range v {
+			if isJSONLDArticleType(entry) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseJSONLDArticle(node map[string]interface{}) jsonLDArticle {
+	var article jsonLDArticle
+	article.Headline, _ = node["headline"].(string)
+	article.Headline = strings.TrimSpace(article.Headline)
+
+	if date, ok := node["datePublished"].(string); ok {
+		for _, layout := range jsonLDDateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(date)); err == nil {
+				article.Published = t.UTC()
+				break
+			}
+		}
+	}
+
+	var authors []string
+	for _, author := range jsonLDList(node["author"]) {
+		if name := jsonLDName(author, "name"); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	article.Author = strings.Join(authors, ", ")
+
+	if images := jsonLDList(node["image"]); len(images) > 0 {
+		article.Image = jsonLDName(images[0], "url")
+	}
+	return article
+}
+
+// jsonLDList treats a single value as a list of one
+func jsonLDList(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	if v == nil {
+		return nil
+	}
+	return []interface{}{v}
+}
+
+// jsonLDName returns v itself when it is a string, or its key property when
+// it is an object such as a Person or ImageObject
+func jsonLDName(v interface{}, key string) string {
+	switch value := v.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case map[string]interface{}:
+		name, _ := value[key].(string)
+		return strings.TrimSpace(name)
+	}
+	return ""
+}
+
+// applyJSONLD overrides the item's title, date, author and image with the
+// values the JSON-LD block provides
+func applyJSONLD(item *Item, article jsonLDArticle, siteConfig SiteConfig) {
+	if article.Headline != "" {
+		item.Title = article.Headline
+	}
+	if !article.Published.IsZero() {
+		item.Created = article.Published
+	}
+	if article.Author != "" {
+		item.Author = &feeds.Author{Name: article.Author}
+	}
+	if article.Image != "" {
+		item.Image = absoluteURL(siteConfig.URL, article.Image)
+		if siteConfig.HTTPSImages {
+			item.Image = upgradeHTTPS(item.Image)
+		}
+		item.Image = proxyImage(item.Image, siteConfig)
+	}
+}
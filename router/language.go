@@ -0,0 +1,60 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/abadojack/whatlanggo"
+)
+
+// languageSampleChars bounds the text given to the detector; the start of an
+// article identifies its language as well as the whole of it
+const languageSampleChars = 1000
+
+// languageCodes maps ISO 639-1 codes to the languages the detector knows
+var languageCodes = func() map[string]whatlanggo.Lang {
+	codes := make(map[string]whatlanggo.Lang)
+	for lang := whatlanggo.Afr; lang <= whatlanggo.Zul; lang++ {
+		if code := lang.Iso6391(); code != "" {
+			codes[code] = lang
+		}
+	}
+	return codes
+}()
+
+// languageOptions restricts detection to the configured languages, which
+// avoids confusing closely related ones the site never publishes in
+func languageOptions(codes []string, site string) (whatlanggo.Options, error) {
+	var options whatlanggo.Options
+	if len(codes) == 0 {
+		return options, nil
+	}
+	options.Whitelist = make(map[whatlanggo.Lang]bool, len(codes))
+	for _, code := range codes {
+		lang, ok := languageCodes[strings.ToLower(strings.TrimSpace(code))]
+		if !ok {
+			return options, fmt.Errorf("invalid detect_languages entry for site %s: %q", site, code)
+		}
+		options.Whitelist[lang] = true
+	}
+	return options, nil
+}
+
+// detectLanguages tags each item with the ISO 639-1 code of the language of
+// its title and content. Items whose language cannot be told reliably, such
+// as very short ones, are left untagged.
+func detectLanguages(items []*Item, siteConfig SiteConfig) {
+	for _, item := range items {
+		text := item.Description
+		if doc, err := goquery.NewDocumentFromReader(strings.NewReader(item.Description)); err == nil {
+			text = doc.Text()
+		}
+		text = truncateRunes(strings.Join(strings.Fields(item.Title+" "+text), " "), languageSampleChars)
+
+		info := whatlanggo.DetectWithOptions(text, siteConfig.languages)
+		if info.IsReliable() {
+			item.Language = info.Lang.Iso6391()
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics exposed on /metrics, labelled by site name
+var (
+	rssGenerations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_router_generations_total",
+		Help: "Total number of RSS generations per site and outcome.",
+	}, []string{"site", "status"})
+
+	generationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rss_router_generation_duration_seconds",
+		Help:    "Time taken to generate an RSS feed.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"site"})
+
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rss_router_fetch_duration_seconds",
+		Help:    "Time taken to fetch an upstream URL.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"site"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_router_cache_requests_total",
+		Help: "Cache lookups by result (hit or miss).",
+	}, []string{"site", "result"})
+
+	upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_router_upstream_errors_total",
+		Help: "Total number of failed upstream fetches.",
+	}, []string{"site"})
+
+	feedItems = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rss_router_feed_items",
+		Help:    "Number of items in generated feeds.",
+		Buckets: prometheus.LinearBuckets(0, 10, 10),
+	}, []string{"site"})
+
+	itemClicks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_router_item_clicks_total",
+		Help: "Total number of item links followed through /click.",
+	}, []string{"site"})
+)
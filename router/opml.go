@@ -0,0 +1,68 @@
+package router
+
+import (
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated"`
+	} `xml:"head"`
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+type opmlOutline struct {
+	Type    string `xml:"type,attr"`
+	Text    string `xml:"text,attr"`
+	Title   string `xml:"title,attr"`
+	XMLURL  string `xml:"xmlUrl,attr"`
+	HTMLURL string `xml:"htmlUrl,attr,omitempty"`
+}
+
+// opmlHandler lists the feeds of this router's sites as OPML, for importing
+// them all into a reader at once. A router only knows its own configuration,
+// so when several are mounted side by side each lists just its own sites.
+func (rt *Router) opmlHandler(w http.ResponseWriter, r *http.Request) {
+	baseURL := rt.publicURL(r)
+
+	names := make([]string, 0, len(rt.config.Sites))
+	for name := range rt.config.Sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	doc := opmlDocument{Version: "2.0"}
+	doc.Head.Title = "rss-router feeds"
+	doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+	for _, name := range names {
+		siteConfig := rt.config.Sites[name]
+		title := siteConfig.Title
+		if title == "" {
+			title = name
+		}
+		doc.Outlines = append(doc.Outlines, opmlOutline{
+			Type:    "rss",
+			Text:    title,
+			Title:   title,
+			XMLURL:  baseURL + "/generate_rss?" + url.Values{"site": {name}}.Encode(),
+			HTMLURL: siteConfig.URL,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		slog.Error("Error writing OPML", "error", err)
+	}
+}
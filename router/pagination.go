@@ -0,0 +1,93 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxPerPage bounds the page size a request can ask for
+const maxPerPage = 1000
+
+// parsePage reads the page number of a feed request, defaulting to the first
+func parsePage(value string) (int, error) {
+	if value == "" {
+		return 1, nil
+	}
+	page, err := strconv.Atoi(value)
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("invalid page: %q", value)
+	}
+	return page, nil
+}
+
+// parsePerPage reads the page size a feed request asks for, 0 when it uses
+// the site's page_size
+func parsePerPage(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 || size > maxPerPage {
+		return 0, fmt.Errorf("invalid per_page: %q", value)
+	}
+	return size, nil
+}
+
+// feedPage is the page of a feed a request asks for
+type feedPage struct {
+	number  int
+	size    int
+	perPage bool   // The size was requested with per_page, which the links keep
+	format  string // Format of the linked pages
+	baseURL string // Public URL of this server
+}
+
+// paginateFeed returns the requested page of a feed split into pages of
+// page.size items, linked to its neighbours. The feed itself is left
+// untouched, as it may be shared with later requests. ok is false when the
+// page is past the last one.
+func paginateFeed(feed *Feed, site string, page feedPage) (paged *Feed, ok bool) {
+	start := (page.number - 1) * page.size
+	if start >= len(feed.Items) && page.number > 1 {
+		return nil, false
+	}
+	end := min(start+page.size, len(feed.Items))
+
+	paged = &Feed{}
+	*paged = *feed
+	paged.Items = feed.Items[start:end]
+	if page.number > 1 {
+		paged.Previous = page.url(site, page.number-1)
+	}
+	if end < len(feed.Items) {
+		paged.Next = page.url(site, page.number+1)
+	}
+	return paged, true
+}
+
+// url returns the public URL of another page of the same feed
+func (page feedPage) url(site string, number int) string {
+	query := url.Values{"site": {site}, "page": {strconv.Itoa(number)}}
+	if page.perPage {
+		query.Set("per_page", strconv.Itoa(page.size))
+	}
+	if page.format != formatRSS {
+		query.Set("format", page.format)
+	}
+	return page.baseURL + "/generate_rss?" + query.Encode()
+}
+
+// publicURL returns base_url, or the URL of the server the request was sent
+// to when it is unset
+func (rt *Router) publicURL(r *http.Request) string {
+	if rt.config.BaseURL != "" {
+		return rt.config.BaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
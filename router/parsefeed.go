@@ -0,0 +1,285 @@
+package router
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gorilla/feeds"
+)
+
+// sourceFeed holds the parts of an RSS 2.0 or Atom document that are carried
+// over when an existing feed is parsed. The element names of both formats
+// are listed, as only one of them is present in any document.
+type sourceFeed struct {
+	XMLName xml.Name
+	Channel struct {
+		Title       string          `xml:"title"`
+		Link        string          `xml:"link"`
+		Description string          `xml:"description"`
+		Items       []sourceRSSItem `xml:"item"`
+	} `xml:"channel"`
+
+	// Atom
+	Title    string            `xml:"title"`
+	Subtitle string            `xml:"subtitle"`
+	Links    []sourceAtomLink  `xml:"link"`
+	Entries  []sourceAtomEntry `xml:"entry"`
+}
+
+type sourceRSSItem struct {
+	Title          string `xml:"title"`
+	Link           string `xml:"link"`
+	Description    string `xml:"description"`
+	ContentEncoded string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Author         string `xml:"author"`
+	PubDate        string `xml:"pubDate"`
+	Comments       string `xml:"comments"`
+	GUID           struct {
+		ID          string `xml:",chardata"`
+		IsPermaLink string `xml:"isPermaLink,attr"`
+	} `xml:"guid"`
+	Categories []string `xml:"category"`
+	Enclosure  *struct {
+		URL    string `xml:"url,attr"`
+		Length string `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	} `xml:"enclosure"`
+}
+
+type sourceAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type sourceAtomEntry struct {
+	Title     string           `xml:"title"`
+	ID        string           `xml:"id"`
+	Links     []sourceAtomLink `xml:"link"`
+	Published string           `xml:"published"`
+	Updated   string           `xml:"updated"`
+	Summary   string           `xml:"summary"`
+	Content   string           `xml:"content"`
+	Author    struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+// feedDateLayouts are the date formats found in RSS and Atom feeds
+var feedDateLayouts = []string{time.RFC1123Z, time.RFC1123, time.RFC3339, time.RFC822Z, time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700"}
+
+// buildFeedFromRSS parses the site's existing RSS or Atom feed and runs its
+// items through the same processing as scraped articles
+func (rt *Router) buildFeedFromRSS(ctx context.Context, siteConfig SiteConfig, budget *retryBudget) (*Feed, error) {
+	title, link, description, items, err := rt.existingFeedItems(ctx, siteConfig, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	if siteConfig.Title != "" {
+		title = siteConfig.Title
+	}
+	if siteConfig.Description != "" {
+		description = siteConfig.Description
+	}
+	if link == "" {
+		link = siteConfig.URL
+	}
+	return rt.newFeed(ctx, title, link, description, items, siteConfig, budget), nil
+}
+
+// buildMergedFeed combines the scraped articles with the items of the site's
+// existing feed, for sites whose official feed is incomplete. Items are
+// matched by link and the scraped version is kept; the result is ordered
+// newest first, as the two sources have no common order.
+func (rt *Router) buildMergedFeed(ctx context.Context, siteConfig SiteConfig, budget *retryBudget) (*Feed, error) {
+	items, doc, err := rt.scrapeItems(ctx, siteConfig, budget)
+	if err != nil {
+		return nil, err
+	}
+	title, _, feedDescription, feedItems, err := rt.existingFeedItems(ctx, siteConfig, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		seen[cacheKey(item.Link.Href)] = true
+	}
+	merged := 0
+	for _, item := range feedItems {
+		if key := cacheKey(item.Link.Href); !seen[key] {
+			seen[key] = true
+			items = append(items, item)
+			merged++
+		}
+	}
+	slog.Debug("Merged existing feed", "site", siteConfig.Name, "added", merged)
+	sortNewestFirst(items, siteConfig)
+
+	if siteConfig.Title != "" {
+		title = siteConfig.Title
+	}
+	description := siteConfig.Description
+	if description == "" {
+		description = feedDescription
+	}
+	if description == "" {
+		description = pageDescription(doc)
+	}
+	feed := rt.newFeed(ctx, title, siteConfig.URL, description, items, siteConfig, budget)
+	discoverIcons(feed, doc, siteConfig)
+	return feed, nil
+}
+
+// existingFeedItems fetches and parses the site's existing RSS or Atom feed,
+// returning its channel metadata and items
+func (rt *Router) existingFeedItems(ctx context.Context, siteConfig SiteConfig, budget *retryBudget) (title, link, description string, items []*Item, err error) {
+	content, err := rt.fetchURLContent(ctx, siteConfig.Name, siteConfig.ExistingRSSURL, budget)
+	if err != nil {
+		return "", "", "", nil, fmt.Errorf("failed to fetch existing RSS: %v", err)
+	}
+
+	var source sourceFeed
+	if err := unmarshalXML(content, &source); err != nil {
+		return "", "", "", nil, fmt.Errorf("failed to parse existing RSS: %v", err)
+	}
+
+	fetched := rt.fetchedAt(siteConfig.ExistingRSSURL)
+	// Undated items of a file:// feed are as old as the file
+	if modTime, ok := rt.fileModTime(siteConfig.ExistingRSSURL); ok && siteConfig.FileDates {
+		fetched = modTime
+	}
+	switch source.XMLName.Local {
+	case "rss":
+		title, link, description = source.Channel.Title, source.Channel.Link, source.Channel.Description
+		for _, sourceItem := range source.Channel.Items {
+			items = append(items, rssSourceItem(sourceItem, siteConfig, fetched))
+		}
+	case "feed":
+		title, link, description = source.Title, atomLink(source.Links), source.Subtitle
+		for _, entry := range source.Entries {
+			items = append(items, atomSourceItem(entry, siteConfig, fetched))
+		}
+	default:
+		return "", "", "", nil, fmt.Errorf("existing feed has unsupported root element <%s>", source.XMLName.Local)
+	}
+	slog.Debug("Parsed existing feed", "site", siteConfig.Name, "count", len(items))
+	return title, link, description, items, nil
+}
+
+func rssSourceItem(sourceItem sourceRSSItem, siteConfig SiteConfig, fetched time.Time) *Item {
+	link := itemLink(strings.TrimSpace(sourceItem.Link), siteConfig)
+	description := sourceItem.ContentEncoded
+	if description == "" {
+		description = sourceItem.Description
+	}
+
+	item := &Item{
+		Item: &feeds.Item{
+			Title:       strings.TrimSpace(sourceItem.Title),
+			Link:        &feeds.Link{Href: link},
+			Description: sourceContent(description, siteConfig),
+			Created:     parseFeedDate(sourceItem.PubDate, fetched),
+			Id:          strings.TrimSpace(sourceItem.GUID.ID),
+			IsPermaLink: sourceItem.GUID.IsPermaLink,
+		},
+		Categories: sourceItem.Categories,
+		Comments:   strings.TrimSpace(sourceItem.Comments),
+	}
+	if sourceItem.Author != "" {
+		item.Author = &feeds.Author{Name: strings.TrimSpace(sourceItem.Author)}
+	}
+	if sourceItem.Enclosure != nil {
+		item.Enclosure = &feeds.Enclosure{Url: sourceItem.Enclosure.URL, Length: sourceItem.Enclosure.Length, Type: sourceItem.Enclosure.Type}
+	}
+	if item.Id == "" {
+		item.Id = linkGUID(link, siteConfig)
+		if item.Id != link {
+			item.IsPermaLink = "false"
+		}
+	}
+	return item
+}
+
+func atomSourceItem(entry sourceAtomEntry, siteConfig SiteConfig, fetched time.Time) *Item {
+	link := itemLink(atomLink(entry.Links), siteConfig)
+	description := entry.Content
+	if description == "" {
+		description = entry.Summary
+	}
+	date := entry.Published
+	if date == "" {
+		date = entry.Updated
+	}
+
+	item := &Item{
+		Item: &feeds.Item{
+			Title:       strings.TrimSpace(entry.Title),
+			Link:        &feeds.Link{Href: link},
+			Description: sourceContent(description, siteConfig),
+			Created:     parseFeedDate(date, fetched),
+			Id:          strings.TrimSpace(entry.ID),
+		},
+	}
+	if entry.Author.Name != "" {
+		item.Author = &feeds.Author{Name: strings.TrimSpace(entry.Author.Name)}
+	}
+	for _, category := range entry.Categories {
+		if category.Term != "" {
+			item.Categories = append(item.Categories, category.Term)
+		}
+	}
+	if item.Id == "" {
+		item.Id = linkGUID(link, siteConfig)
+	}
+	if item.Id != link {
+		item.IsPermaLink = "false"
+	}
+	return item
+}
+
+// atomLink returns the alternate link of an Atom feed or entry
+func atomLink(links []sourceAtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	return ""
+}
+
+// sourceContent applies the site's content settings to the HTML of an item
+// taken from an existing feed
+func sourceContent(description string, siteConfig SiteConfig) string {
+	if !siteConfig.StripUnsafeAttributes && len(siteConfig.IframeAllowlist) == 0 && siteConfig.TruncateAt == "" && siteConfig.PictureSource == "" && !siteConfig.HTTPSImages && siteConfig.imageProxy == "" {
+		return description
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(description))
+	if err != nil {
+		return description
+	}
+	return contentHTML(doc.Find("body"), siteConfig)
+}
+
+// parseFeedDate parses an RSS or Atom date, falling back to the fetch time
+func parseFeedDate(date string, fetched time.Time) time.Time {
+	date = strings.TrimSpace(date)
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t.UTC()
+		}
+	}
+	if date != "" {
+		slog.Warn("Error parsing feed date, using fetch time instead", "date", date)
+	}
+	return fetched.UTC()
+}
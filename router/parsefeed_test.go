@@ -0,0 +1,113 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// latin1Server serves body, written in ISO-8859-1, as contentType
+func latin1Server(t *testing.T, contentType, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestExistingFeedItems(t *testing.T) {
+	// "Café" and "Crème" in ISO-8859-1
+	srv := latin1Server(t, "application/rss+xml", `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0"><channel><title>Caf`+"\xe9"+`</title><link>https://example.com/</link>
+<item><title>Cr`+"\xe8"+`me</title><link>https://example.com/post?id=1&amp;utm_source=rss</link><guid isPermaLink="false">post-1</guid></item>
+<item><title>Plain</title><link>https://example.com/post?id=2&amp;utm_source=rss</link></item>
+</channel></rss>`)
+
+	rt, siteConfig := testRouter(t, SiteConfig{
+		URL:              "https://example.com/",
+		ExistingRSSURL:   srv.URL,
+		ParseExistingRSS: true,
+		GUIDStripQuery:   true,
+	}, srv.Client())
+	title, _, _, items, err := rt.existingFeedItems(context.Background(), siteConfig, newRetryBudget(rt.config.RetryBudget))
+	if err != nil {
+		t.Fatalf("existingFeedItems() error = %v", err)
+	}
+	if title != "Café" {
+		t.Errorf("title = %q, want %q", title, "Café")
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	if items[0].Title != "Crème" || items[0].Id != "post-1" || items[0].IsPermaLink != "false" {
+		t.Errorf("first item = %q, GUID %q, isPermaLink %q", items[0].Title, items[0].Id, items[0].IsPermaLink)
+	}
+	// The GUID synthesized from the link is not the link, so not a permalink
+	if items[1].Id != "https://example.com/post" || items[1].IsPermaLink != "false" {
+		t.Errorf("second item GUID %q, isPermaLink %q, want %q, %q", items[1].Id, items[1].IsPermaLink, "https://example.com/post", "false")
+	}
+}
+
+func TestReadSitemapEncoding(t *testing.T) {
+	srv := latin1Server(t, "application/xml", `<?xml version="1.0" encoding="ISO-8859-1"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://example.com/caf`+"\xe9"+`</loc><lastmod>2024-05-01</lastmod></url>
+</urlset>`)
+
+	rt, siteConfig := testRouter(t, SiteConfig{URL: "https://example.com/", SitemapDates: true, SitemapURL: srv.URL}, srv.Client())
+	dates, err := rt.readSitemap(context.Background(), siteConfig, srv.URL, newRetryBudget(rt.config.RetryBudget))
+	if err != nil {
+		t.Fatalf("readSitemap() error = %v", err)
+	}
+	want := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	if got, ok := dates[sitemapKey("https://example.com/café")]; !ok || !got.Equal(want) {
+		t.Errorf("date of https://example.com/café = %v, %v, want %v; read %v", got, ok, want, dates)
+	}
+}
+
+func TestExistingFeedFullContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Upstream</title><link>https://example.com/</link>
+<item><title>One</title><link>http://` + r.Host + `/post/1</link><description>Summary one</description></item>
+<item><title>Two</title><link>http://` + r.Host + `/post/2</link><description>Summary two</description></item>
+</channel></rss>`))
+		case "/post/1":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><body><nav>Menu</nav><div class="body"><p>Full text one</p></div></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// Without parse_existing_rss, which full_content_selector implies
+	rt, _ := testRouter(t, SiteConfig{
+		URL:                 srv.URL,
+		ExistingRSSURL:      srv.URL + "/feed.xml",
+		FullContentSelector: "div.body",
+	}, srv.Client())
+	rec := httptest.NewRecorder()
+	rt.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/generate_rss?site=test", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Full text one", "Summary two"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("feed lacks %q:\n%s", want, body)
+		}
+	}
+	for _, unwanted := range []string{"Summary one", "Menu"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("feed contains %q:\n%s", unwanted, body)
+		}
+	}
+}
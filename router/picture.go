@@ -0,0 +1,75 @@
+package router
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// pictureLargest is the picture_source value that picks the largest image
+// offered by any source of a <picture>
+const pictureLargest = "largest"
+
+var srcsetSeparator = regexp.MustCompile(`,\s+`)
+
+// pictureImage returns the absolute URL of the image a <picture> element
+// should be rendered with: the largest candidate of the sources matching
+// picture_source, falling back to the src of its <img>
+func pictureImage(picture *goquery.Selection, siteConfig SiteConfig) string {
+	sources := picture.Find("source, img")
+	if siteConfig.PictureSource != pictureLargest {
+		sources = siteConfig.matchers.find(picture, siteConfig.PictureSource)
+	}
+
+	var best string
+	bestSize := 0.0
+	sources.Each(func(i int, s *goquery.Selection) {
+		for _, candidate := range srcsetSeparator.Split(strings.TrimSpace(s.AttrOr("srcset", "")), -1) {
+			fields := strings.Fields(strings.TrimSuffix(candidate, ","))
+			if len(fields) == 0 {
+				continue
+			}
+			if size := candidateSize(fields[1:]); best == "" || size > bestSize {
+				best, bestSize = fields[0], size
+			}
+		}
+	})
+	if best == "" {
+		best = strings.TrimSpace(picture.Find("img").AttrOr("src", ""))
+	}
+	if best == "" {
+		return ""
+	}
+	return absoluteURL(siteConfig.URL, best)
+}
+
+// candidateSize reads the width ("800w") or pixel density ("2x") descriptor
+// of a srcset candidate. Widths are in pixels and so outrank densities.
+func candidateSize(descriptors []string) float64 {
+	if len(descriptors) == 0 {
+		return 1
+	}
+	d := descriptors[0]
+	value, err := strconv.ParseFloat(d[:len(d)-1], 64)
+	if err != nil {
+		return 1
+	}
+	return value
+}
+
+// flattenPictures replaces each <picture> in contentTag with a plain <img>
+// of its selected source, as most feed readers ignore <source> elements
+func flattenPictures(contentTag *goquery.Selection, siteConfig SiteConfig) {
+	contentTag.Find("picture").Each(func(i int, s *goquery.Selection) {
+		src := pictureImage(s, siteConfig)
+		if src == "" {
+			return
+		}
+		alt := s.Find("img").AttrOr("alt", "")
+		s.ReplaceWithHtml(fmt.Sprintf("<img src=\"%s\" alt=\"%s\"/>", html.EscapeString(src), html.EscapeString(alt)))
+	})
+}
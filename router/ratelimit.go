@@ -0,0 +1,128 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitConfig limits outbound requests per host. Rate is in requests per
+// second; a zero rate disables limiting. Hosts overrides the limit for
+// individual hosts.
+type RateLimitConfig struct {
+	Rate  float64                    `yaml:"rate"`
+	Burst int                        `yaml:"burst"`
+	Hosts map[string]RateLimitConfig `yaml:"hosts"`
+}
+
+// hostLimiter returns the limiter for host, creating it on first use.
+// It returns nil when requests to host are not rate limited.
+func (rt *Router) hostLimiter(host string) *rate.Limiter {
+	rt.limiters.Lock()
+	defer rt.limiters.Unlock()
+
+	if limiter, ok := rt.limiters.byHost[host]; ok {
+		return limiter
+	}
+
+	limit := rt.config.RateLimit
+	if hostLimit, ok := rt.config.RateLimit.Hosts[host]; ok {
+		limit = hostLimit
+	}
+
+	var limiter *rate.Limiter
+	if limit.Rate > 0 {
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(limit.Rate), burst)
+	}
+	rt.limiters.byHost[host] = limiter
+	return limiter
+}
+
+// waitForRateLimit blocks until a request to the host of rawURL is allowed,
+// giving up once the fetch timeout would be exceeded or ctx is done.
+func (rt *Router) waitForRateLimit(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+
+	limiter := rt.hostLimiter(u.Hostname())
+	if limiter == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rt.config.FetchTimeout)
+	defer cancel()
+	if err := limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit for %s exceeded: %v", u.Hostname(), err)
+	}
+	return nil
+}
+
+// withinFetchInterval returns the last fetched content of key, even once the
+// cache has expired it, while the site's min_fetch_interval has not passed
+// since its last upstream fetch
+func (rt *Router) withinFetchInterval(site, key string) ([]byte, bool) {
+	interval := rt.config.Sites[site].MinFetchInterval
+	if interval <= 0 {
+		return nil, false
+	}
+	rt.lastFetches.Lock()
+	last, ok := rt.lastFetches.bySite[site]
+	rt.lastFetches.Unlock()
+	if !ok || time.Since(last) >= interval {
+		return nil, false
+	}
+	entry, ok := rt.cache.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	slog.Debug("Serving last fetch within min_fetch_interval", "site", site, "url", key, "age", time.Since(entry.fetched))
+	return entry.content, true
+}
+
+// reserveFetch records an upstream fetch for site if interval has passed
+// since its last one, or returns how long is left otherwise
+func (rt *Router) reserveFetch(site string, interval time.Duration) time.Duration {
+	rt.lastFetches.Lock()
+	defer rt.lastFetches.Unlock()
+	if last, ok := rt.lastFetches.bySite[site]; ok {
+		if left := interval - time.Since(last); left > 0 {
+			return left
+		}
+	}
+	rt.lastFetches.bySite[site] = time.Now()
+	return 0
+}
+
+// waitForFetchInterval blocks until the site's min_fetch_interval allows
+// another upstream fetch, whatever its URL, and records it. A wait longer
+// than the fetch timeout fails instead of holding the request open.
+func (rt *Router) waitForFetchInterval(ctx context.Context, site string) error {
+	interval := rt.config.Sites[site].MinFetchInterval
+	if interval <= 0 {
+		return nil
+	}
+	for {
+		left := rt.reserveFetch(site, interval)
+		if left == 0 {
+			return nil
+		}
+		if left > rt.config.FetchTimeout {
+			return fmt.Errorf("min_fetch_interval for site %s allows the next upstream fetch in %s", site, left.Round(time.Second))
+		}
+		select {
+		case <-time.After(left):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMinFetchInterval(t *testing.T) {
+	t.Run("longer than the fetch timeout", func(t *testing.T) {
+		srv, hits := countingServer(t)
+		rt, _ := testRouter(t, SiteConfig{URL: srv.URL, MinFetchInterval: time.Hour}, srv.Client())
+		fetch := func(path string) error {
+			_, err := rt.fetchURLContent(context.Background(), "test", srv.URL+path, newRetryBudget(0))
+			return err
+		}
+
+		if err := fetch("/"); err != nil {
+			t.Fatalf("first fetch error = %v", err)
+		}
+		// Another URL of the same site counts against the same interval
+		start := time.Now()
+		if err := fetch("/article"); err == nil {
+			t.Error("fetch of another URL within the interval succeeded, want an error")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("fetch within the interval took %v, want it to fail fast", elapsed)
+		}
+		// The last content is still served within the interval...
+		if err := fetch("/"); err != nil {
+			t.Errorf("cached fetch error = %v", err)
+		}
+		// ...but once invalidated, the URL fails instead of sitting out an hour
+		rt.cache.invalidate(func(url, site string) bool { return true })
+		if err := fetch("/"); err == nil {
+			t.Error("fetch after an invalidation succeeded, want an error")
+		}
+		if got := hits.Load(); got != 1 {
+			t.Errorf("upstream hit %d times, want 1", got)
+		}
+	})
+
+	t.Run("shorter than the fetch timeout", func(t *testing.T) {
+		srv, hits := countingServer(t)
+		interval := 100 * time.Millisecond
+		rt, _ := testRouter(t, SiteConfig{URL: srv.URL, MinFetchInterval: interval}, srv.Client())
+
+		start := time.Now()
+		for _, path := range []string{"/", "/article"} {
+			if _, err := rt.fetchURLContent(context.Background(), "test", srv.URL+path, newRetryBudget(0)); err != nil {
+				t.Fatalf("fetch of %s error = %v", path, err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < interval {
+			t.Errorf("two URLs fetched in %v, want the second to wait for the %v interval", elapsed, interval)
+		}
+		if got := hits.Load(); got != 2 {
+			t.Errorf("upstream hit %d times, want 2", got)
+		}
+	})
+}
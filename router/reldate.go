@@ -0,0 +1,133 @@
+package router
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateParseRelative is the date_parse_mode for human dates like "3 days ago"
+const dateParseRelative = "relative"
+
+var (
+	agoPattern       = regexp.MustCompile(`^(\d+|an?|one) ?([a-z]+) ago$`)
+	lastUnitPattern  = regexp.MustCompile(`^last (week|month|year)$`)
+	dayPattern       = regexp.MustCompile(`^(today|yesterday|(?:last )?(?:sun|mon|tue|wed|thu|fri|sat)[a-z]*)(?:,? (?:at )?(.+))?$`)
+	clockPattern     = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))? ?(am|pm)?$`)
+	whitespaceRegexp = regexp.MustCompile(`\s+`)
+)
+
+var relativeUnits = map[string]string{
+	"s": "second", "sec": "second", "secs": "second", "second": "second", "seconds": "second",
+	"m": "minute", "min": "minute", "mins": "minute", "minute": "minute", "minutes": "minute",
+	"h": "hour", "hr": "hour", "hrs": "hour", "hour": "hour", "hours": "hour",
+	"d": "day", "day": "day", "days": "day",
+	"w": "week", "wk": "week", "wks": "week", "week": "week", "weeks": "week",
+	"mo": "month", "mos": "month", "month": "month", "months": "month",
+	"y": "year", "yr": "year", "yrs": "year", "year": "year", "years": "year",
+}
+
+// parseRelativeTime interprets English phrasings such as "just now",
+// "5 mins ago", "an hour ago", "yesterday at 4pm" or "last monday" relative
+// to now. It reports false when the string is not a relative date.
+func parseRelativeTime(dateStr string, now time.Time) (time.Time, bool) {
+	s := strings.ToLower(strings.TrimSpace(whitespaceRegexp.ReplaceAllString(dateStr, " ")))
+
+	switch s {
+	case "now", "just now", "moments ago", "a moment ago", "a few seconds ago", "seconds ago":
+		return now, true
+	}
+
+	if m := agoPattern.FindStringSubmatch(s); m != nil {
+		n := 1
+		if v, err := strconv.Atoi(m[1]); err == nil {
+			n = v
+		}
+		unit, ok := relativeUnits[m[2]]
+		if !ok {
+			return time.Time{}, false
+		}
+		return subtractUnits(now, unit, n), true
+	}
+
+	if m := lastUnitPattern.FindStringSubmatch(s); m != nil {
+		return subtractUnits(now, m[1], 1), true
+	}
+
+	if m := dayPattern.FindStringSubmatch(s); m != nil {
+		day, ok := relativeDay(m[1], now)
+		if !ok {
+			return time.Time{}, false
+		}
+		if m[2] == "" {
+			return day, true
+		}
+		return atClock(day, m[2])
+	}
+
+	return time.Time{}, false
+}
+
+func subtractUnits(now time.Time, unit string, n int) time.Time {
+	switch unit {
+	case "second":
+		return now.Add(-time.Duration(n) * time.Second)
+	case "minute":
+		return now.Add(-time.Duration(n) * time.Minute)
+	case "hour":
+		return now.Add(-time.Duration(n) * time.Hour)
+	case "day":
+		return now.AddDate(0, 0, -n)
+	case "week":
+		return now.AddDate(0, 0, -7*n)
+	case "month":
+		return now.AddDate(0, -n, 0)
+	default:
+		return now.AddDate(-n, 0, 0)
+	}
+}
+
+// relativeDay resolves "today", "yesterday" and weekday names to a day,
+// keeping the clock time of now. Weekdays refer to the most recent past one.
+func relativeDay(name string, now time.Time) (time.Time, bool) {
+	switch name {
+	case "today":
+		return now, true
+	case "yesterday":
+		return now.AddDate(0, 0, -1), true
+	}
+
+	name = strings.TrimPrefix(name, "last ")
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekday := strings.ToLower(d.String())
+		if strings.HasPrefix(weekday, name) {
+			back := (int(now.Weekday()) - int(d) + 7) % 7
+			if back == 0 {
+				back = 7
+			}
+			return now.AddDate(0, 0, -back), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// atClock sets the time of day on day from strings like "4pm" or "16:30"
+func atClock(day time.Time, clock string) (time.Time, bool) {
+	m := clockPattern.FindStringSubmatch(clock)
+	if m == nil {
+		return time.Time{}, false
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	switch {
+	case m[3] == "pm" && hour < 12:
+		hour += 12
+	case m[3] == "am" && hour == 12:
+		hour = 0
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location()), true
+}
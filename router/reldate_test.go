@@ -0,0 +1,38 @@
+package router
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRelativeTime(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2024, time.May, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		in     string
+		want   time.Time
+		wantOK bool
+	}{
+		{"3 days ago", time.Date(2024, time.May, 12, 10, 30, 0, 0, time.UTC), true},
+		{"an hour ago", time.Date(2024, time.May, 15, 9, 30, 0, 0, time.UTC), true},
+		{"  5 mins\tago ", time.Date(2024, time.May, 15, 10, 25, 0, 0, time.UTC), true},
+		{"just now", now, true},
+		{"yesterday at 4pm", time.Date(2024, time.May, 14, 16, 0, 0, 0, time.UTC), true},
+		{"Yesterday, 12am", time.Date(2024, time.May, 14, 0, 0, 0, 0, time.UTC), true},
+		{"last monday", time.Date(2024, time.May, 13, 10, 30, 0, 0, time.UTC), true},
+		{"wednesday", time.Date(2024, time.May, 8, 10, 30, 0, 0, time.UTC), true},
+		{"last month", time.Date(2024, time.April, 15, 10, 30, 0, 0, time.UTC), true},
+		{"sometime next week", time.Time{}, false},
+		{"3 fortnights ago", time.Time{}, false},
+		{"yesterday at 25:00", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := parseRelativeTime(tt.in, now)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("parseRelativeTime(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultRetryBudget = 10
+
+// retryBudget caps the total number of retries performed while serving a
+// single request, no matter how many upstream fetches that request makes.
+// A nil budget places no cap beyond the per-fetch max_retries.
+type retryBudget struct {
+	sync.Mutex
+	remaining int
+}
+
+func newRetryBudget(retries int) *retryBudget {
+	return &retryBudget{remaining: retries}
+}
+
+// take consumes one retry, reporting false when the budget is exhausted
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.remaining <= 0 {
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// Kinds of fetch failure, which decide the retry policy applied
+type failureKind int
+
+const (
+	failurePermanent failureKind = iota // Not worth retrying
+	failureNetwork                      // Network errors and interrupted bodies
+	failureServer                       // 5xx responses
+)
+
+// retryPolicy returns the number of retries and the initial backoff for a
+// failure. Sites may retry 5xx responses differently from network errors.
+func (rt *Router) retryPolicy(site string, failure failureKind) (int, time.Duration) {
+	maxRetries, backoff := rt.config.MaxRetries, rt.config.RetryBackoff
+	if failure != failureServer {
+		return maxRetries, backoff
+	}
+
+	siteConfig := rt.config.Sites[site]
+	if siteConfig.Retry5xxMax != nil {
+		maxRetries = *siteConfig.Retry5xxMax
+	}
+	if siteConfig.Retry5xxBackoff > 0 {
+		backoff = siteConfig.Retry5xxBackoff
+	}
+	return maxRetries, backoff
+}
@@ -0,0 +1,1506 @@
+// Package router generates RSS feeds from web pages using per-site CSS
+// selectors, and serves them over HTTP.
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // default_timezone must resolve even without a system zone database
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/abadojack/whatlanggo"
+	"github.com/gorilla/feeds"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v2"
+)
+
+// SiteConfig represents the configuration for a single website
+type SiteConfig struct {
+	Name              string      `yaml:"-"` // Key of the site in the configuration
+	URL               string      `yaml:"url"`
+	Title             string      `yaml:"title"`
+	Description       string      `yaml:"description"`
+	ArticleSelector   Selectors   `yaml:"article_selector"`
+	TitleSelector     Selectors   `yaml:"title_selector"`
+	LinkSelector      Selectors   `yaml:"link_selector"`
+	DateSelector      Selectors   `yaml:"date_selector"`
+	ContentSelector   Selectors   `yaml:"content_selector"`
+	AuthorSelector    Selectors   `yaml:"author_selector"` // Tried before rel="author" links and, on article pages, the author meta tags
+	DateFormat        string      `yaml:"date_format"`
+	DateAttribute     string      `yaml:"date_attribute"`      // Defaults to datetime, falling back to the element text
+	LinkAttributeName string      `yaml:"link_attribute_name"` // Defaults to href
+	StripQueryParams  []string    `yaml:"strip_query_params"`  // Query parameters removed from links, "utm_*" matches a prefix
+	StripAllQuery     bool        `yaml:"strip_all_query"`     // Remove the whole query string from links
+	CommentsSelector  string      `yaml:"comments_selector"`   // Element whose href links to the discussion thread
+	ExistingRSSURL    string      `yaml:"existing_rss_url"`    // New field for existing RSS URL
+	ParseExistingRSS  bool        `yaml:"parse_existing_rss"`  // Process the existing feed's items instead of passing it through
+	MergeExistingRSS  bool        `yaml:"merge_existing_rss"`  // Combine the existing feed's items with the scraped ones
+	CategorySelector  string      `yaml:"category_selector"`
+	GUIDSelector      string      `yaml:"guid_selector"`    // Element holding a stable item ID, ":self" for the article
+	GUIDAttr          string      `yaml:"guid_attr"`        // Attribute holding the ID, the element text is used when unset
+	GUIDStripQuery    bool        `yaml:"guid_strip_query"` // Identify items by their link without its query string
+	CanonicalGUID     bool        `yaml:"canonical_guid"`   // Use the canonical URL declared by each article page as its GUID
+	GallerySelector   string      `yaml:"gallery_selector"`
+	GalleryAttribute  string      `yaml:"gallery_attribute"` // Attribute holding the image URL, defaults to src
+	PictureSource     string      `yaml:"picture_source"`    // "largest" or a selector for the <source> of <picture> elements to use
+	DefaultTimezone   string      `yaml:"default_timezone"`  // Zone for dates that carry no zone of their own
+	DateParseMode     string      `yaml:"date_parse_mode"`   // "relative" for dates like "3 days ago"
+	EnclosureSelector string      `yaml:"enclosure_selector"`
+	EnclosureAttr     string      `yaml:"enclosure_attr"`        // Attribute holding the media URL, defaults to src or href
+	EnclosureType     string      `yaml:"enclosure_type"`        // MIME type, detected when unset
+	EnclosureLength   string      `yaml:"enclosure_length_attr"` // Attribute holding the size in bytes
+	EnclosureHead     bool        `yaml:"enclosure_head"`        // Issue a HEAD request when length or type is unknown
+	Proxy             string      `yaml:"proxy"`                 // http(s):// or socks5:// proxy for this site's requests
+	ForceHTTP1        bool        `yaml:"force_http1"`           // Never use HTTP/2, for upstreams that reset HTTP/2 streams
+	WarmupURL         string      `yaml:"warmup_url"`            // Fetched first to collect cookies the site requires
+	UserAgents        []string    `yaml:"user_agents"`           // User-Agent headers used in turn for the site's requests
+	UserAgentRotation string      `yaml:"user_agent_rotation"`   // "round_robin" (default) or "random"
+	Auth              *AuthConfig `yaml:"auth"`                  // Credentials for sites behind basic or bearer auth
+	Soft404Selector   string      `yaml:"soft_404_selector"`     // Element only present on the site's "not found" page
+	Soft404Text       string      `yaml:"soft_404_text"`         // Text only present on the site's "not found" page
+	ChallengeSelector string      `yaml:"challenge_selector"`    // Element only present on the site's bot challenge page
+	ChallengeText     string      `yaml:"challenge_text"`        // Text only present on the site's bot challenge page
+
+	StripUnsafeAttributes bool     `yaml:"strip_unsafe_attributes"` // Drop on* handlers and javascript: URLs from content
+	IframeAllowlist       []string `yaml:"iframe_allowlist"`        // Domains whose iframe embeds are kept, removing all others
+	TruncateAt            string   `yaml:"truncate_at"`             // Content is cut before the first element matching this selector
+
+	JSONAPI *JSONAPIConfig `yaml:"json_api"` // Build the feed from a JSON API instead of the HTML page
+
+	HTTPSLinks  bool `yaml:"https_links"`  // Rewrite http:// item links to https://
+	HTTPSImages bool `yaml:"https_images"` // Rewrite http:// image sources in the content to https://
+
+	ProxyImages bool     `yaml:"proxy_images"` // Serve the site's images through the /image endpoint, requires base_url
+	ImageHosts  []string `yaml:"image_hosts"`  // Domains whose images proxy_images serves, default the host of url
+
+	TrackClicks  bool     `yaml:"track_clicks"`  // Link items through the /click endpoint, which logs clicks, requires base_url
+	ClickDomains []string `yaml:"click_domains"` // Domains /click redirects to, default the host of url
+
+	MinFetchInterval    time.Duration `yaml:"min_fetch_interval"`   // Minimum time between upstream fetches for the site, whatever the cache does
+	ConditionalUpstream bool          `yaml:"conditional_upstream"` // Revalidate the source with ETag/Last-Modified and answer 304 while it is unchanged
+
+	Retry5xxMax     *int          `yaml:"retry_5xx_max"`     // Retries for 5xx responses, overriding max_retries
+	Retry5xxBackoff time.Duration `yaml:"retry_5xx_backoff"` // Initial backoff for 5xx responses, overriding retry_backoff
+
+	DedupHash         string `yaml:"dedup_hash"`          // Also drop items with the same "title_link" or "title_content" as an earlier one
+	DedupContentChars int    `yaml:"dedup_content_chars"` // Characters of content hashed by title_content, default 200
+
+	MaxItems     int    `yaml:"max_items"`      // Maximum number of items in the feed, 0 for no limit
+	MinItems     int    `yaml:"min_items"`      // Fewer parsed items are treated as a broken selector
+	MaxItemsMode string `yaml:"max_items_mode"` // "document" keeps the first items on the page, "newest" the most recent
+	TieBreaker   string `yaml:"tie_breaker"`    // Order of items with the same date when sorting: "document" (default) or "link"
+
+	Namespaces      map[string]string `yaml:"namespaces"`       // Prefixes and URIs of the custom item elements
+	ItemAttributes  map[string]string `yaml:"item_attributes"`  // Article element attributes copied into custom elements, e.g. data-score: myns:score
+	ChecksumElement string            `yaml:"checksum_element"` // Custom element holding a SHA-256 of each item's content, e.g. myns:checksum
+
+	ReplaceGenericTitles  bool     `yaml:"replace_generic_titles"`  // Replace URL or "Read more" titles with a better one from the article
+	GenericTitles         []string `yaml:"generic_titles"`          // Titles treated as generic, replacing the default list
+	TitleFallbackSelector string   `yaml:"title_fallback_selector"` // Element tried first for a replacement title
+
+	AttributeFallback bool `yaml:"attribute_fallback"` // Use the title, aria-label or alt attribute of title and content elements without text
+
+	JoinTitleText bool `yaml:"join_title_text"` // Join the text of the title's elements with single spaces
+
+	MissingDates string `yaml:"missing_dates"` // "document_order" dates undated sites one second apart in page order
+
+	SitemapDates bool          `yaml:"sitemap_dates"` // Date articles without a date from the site's sitemap
+	SitemapURL   string        `yaml:"sitemap_url"`   // Defaults to /sitemap.xml on the site's host
+	SitemapTTL   time.Duration `yaml:"sitemap_ttl"`   // How long a parsed sitemap is reused, default 1h
+
+	FileDates bool `yaml:"file_dates"` // Date articles without a date from the modification time of a file:// source
+
+	UseJSONLD bool `yaml:"use_jsonld"` // Prefer the JSON-LD headline, date, author and image over the selectors
+
+	Icon    string `yaml:"icon"`    // JSON Feed icon URL, discovered from the page when unset
+	Favicon string `yaml:"favicon"` // JSON Feed favicon URL, discovered from the page when unset
+
+	PageSize int `yaml:"page_size"` // Items per page, enabling ?page=N; 0 serves all items at once
+
+	DetectLanguage  bool     `yaml:"detect_language"`  // Tag each item with the language detected in its text
+	DetectLanguages []string `yaml:"detect_languages"` // ISO 639-1 codes the detection is limited to
+
+	XSLTURL string `yaml:"xslt_url"` // Stylesheet referenced by the RSS output, overriding the global xslt_url
+
+	FullContentSelector string        `yaml:"full_content_selector"` // Content selector on the linked article pages
+	FullContentDeadline time.Duration `yaml:"full_content_deadline"` // Time allowed for fetching all article pages
+	FullContentFetches  int           `yaml:"full_content_fetches"`  // Article pages fetched at the same time, default 8
+	PreferAMP           bool          `yaml:"prefer_amp"`            // Extract full content from the page's AMP version when it has one
+
+	location   *time.Location
+	imageProxy string   // Prefix of proxied image URLs when proxy_images is set
+	clickURL   string   // Prefix of tracked item links when track_clicks is set
+	matchers   matchers // Compiled selectors
+	languages  whatlanggo.Options
+}
+
+// Values of max_items_mode
+const (
+	maxItemsDocument = "document"
+	maxItemsNewest   = "newest"
+
+	tieBreakerDocument = "document"
+	tieBreakerLink     = "link"
+)
+
+// missingDatesDocumentOrder is the missing_dates mode for sites without
+// dates, which keeps the page order in readers that sort by date
+const missingDatesDocumentOrder = "document_order"
+
+// selfSelector can be used as ContentSelector to take the article element's own HTML as content
+const selfSelector = ":self"
+
+// Config represents the overall configuration
+type Config struct {
+	Sites             map[string]SiteConfig `yaml:"sites"`
+	FetchTimeout      time.Duration         `yaml:"fetch_timeout"`
+	RateLimit         RateLimitConfig       `yaml:"rate_limit"`
+	MaxRetries        int                   `yaml:"max_retries"`
+	RetryBackoff      time.Duration         `yaml:"retry_backoff"`
+	RetryBudget       int                   `yaml:"retry_budget"`        // Retries allowed across all fetches of one request
+	AdminToken        string                `yaml:"admin_token"`         // Shared secret for the cache endpoints
+	LogLevel          string                `yaml:"log_level"`           // debug, info, warn or error; LOG_LEVEL overrides it
+	FeedValidation    string                `yaml:"feed_validation"`     // "log" or "fail" to check generated feeds
+	ReadinessCheck    bool                  `yaml:"readiness_check"`     // Require a reachable site for /readyz
+	ReadinessCheckTTL time.Duration         `yaml:"readiness_check_ttl"` // How long a reachability result is reused
+	StreamThreshold   int                   `yaml:"stream_threshold"`    // Feeds with more items are streamed; 0 always buffers
+	GzipLevel         int                   `yaml:"gzip_level"`          // Response compression level from 1 (fastest) to 9 (smallest)
+	BaseURL           string                `yaml:"base_url"`            // Public URL of this server, for links to its own endpoints
+	StatsHistory      int                   `yaml:"stats_history"`       // Generations per site kept for /stats
+	XSLTURL           string                `yaml:"xslt_url"`            // Stylesheet referenced by generated RSS feeds, for viewing them in browsers
+}
+
+// Item is a feed item together with the data gorilla/feeds has no field for
+type Item struct {
+	*feeds.Item
+	Categories  []string
+	Comments    string             // URL of the discussion thread
+	Image       string             // URL of the article's primary image
+	Elements    []itemElement      // Custom elements from item_attributes
+	Language    string             // ISO 639-1 code detected when detect_language is set
+	Partial     bool               // Full content was requested but could not be fetched
+	FullContent *fullContentResult // Outcome of the full content fetch, reported by /debug
+}
+
+// Feed holds the channel metadata and items of a generated feed
+type Feed struct {
+	*feeds.Feed
+	Items      []*Item
+	Namespaces map[string]string // Prefixes and URIs of the items' custom elements
+	Previous   string            // URL of the previous page of a paginated feed
+	Next       string            // URL of the next page of a paginated feed
+	Icon       string            // Large square image for JSON Feed
+	Favicon    string            // Small icon for JSON Feed
+	Stylesheet string            // URL of the XSLT stylesheet referenced by the RSS output
+}
+
+// newestItemTime returns the date of the most recent item, or the zero time
+// for an empty feed
+func (f *Feed) newestItemTime() time.Time {
+	var newest time.Time
+	for _, item := range f.Items {
+		if item.Created.After(newest) {
+			newest = item.Created
+		}
+	}
+	return newest
+}
+
+const (
+	defaultFetchTimeout = 30 * time.Second
+	defaultRetryBackoff = time.Second
+)
+
+// Router generates feeds for the configured sites. It holds the HTTP clients
+// and the caches shared by all requests.
+type Router struct {
+	config      Config
+	client      *http.Client
+	siteClients map[string]*http.Client // Dedicated clients of sites that need their own transport
+	cache       *pageCache
+	// Enclosure sizes and types learned from HEAD requests
+	enclosureHeads struct {
+		sync.Mutex
+		byURL map[string]feeds.Enclosure
+	}
+	// Last feed that met min_items for each site, served when a later one does not
+	lastGoodFeeds struct {
+		sync.Mutex
+		bySite map[string]*Feed
+	}
+	limiters struct {
+		sync.Mutex
+		byHost map[string]*rate.Limiter
+	}
+	// Time of the last upstream fetch of each site with min_fetch_interval
+	lastFetches struct {
+		sync.Mutex
+		bySite map[string]time.Time
+	}
+	// Recent generations of each site, for /stats
+	stats struct {
+		sync.Mutex
+		bySite map[string]*statsRing
+	}
+	// Validators of the sources of sites with conditional_upstream, and the
+	// feeds last served from them
+	upstream struct {
+		sync.Mutex
+		validators map[string]upstreamValidators
+		served     map[string]servedFeed
+	}
+	// Parsed sitemaps of sites with sitemap_dates
+	sitemaps struct {
+		sync.Mutex
+		byURL    map[string]sitemapEntry
+		inflight singleflight.Group
+	}
+	// Modification time of the file:// sources read
+	files struct {
+		sync.Mutex
+		modTimes map[string]time.Time
+	}
+	// Index of the next of each site's user_agents
+	userAgents struct {
+		sync.Mutex
+		next map[string]int
+	}
+	// Result of the last reachability check
+	readiness struct {
+		sync.Mutex
+		checked time.Time
+		ready   bool
+		report  string
+	}
+}
+
+// LoadConfig reads and parses the YAML configuration file at path
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	configData, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read config file: %v", err)
+	}
+	if err := yaml.Unmarshal(configData, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	return config, nil
+}
+
+// New validates config, fills in its defaults and returns a Router serving
+// it. Upstream requests go through client; when client is nil, one honoring
+// the proxy environment variables and fetch_timeout is created. Sites with
+// their own proxy always get a dedicated client.
+func New(config Config, client *http.Client) (*Router, error) {
+	if config.FeedValidation != "" && config.FeedValidation != validationLog && config.FeedValidation != validationFail {
+		return nil, fmt.Errorf("invalid feed_validation: %q", config.FeedValidation)
+	}
+
+	if config.FetchTimeout <= 0 {
+		config.FetchTimeout = defaultFetchTimeout
+	}
+	if config.ReadinessCheckTTL <= 0 {
+		config.ReadinessCheckTTL = defaultReadinessCheckTTL
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	if config.RetryBudget <= 0 {
+		config.RetryBudget = defaultRetryBudget
+	}
+	if config.StatsHistory <= 0 {
+		config.StatsHistory = defaultStatsHistory
+	}
+	if config.GzipLevel == 0 {
+		config.GzipLevel = defaultGzipLevel
+	} else if config.GzipLevel < gzip.BestSpeed || config.GzipLevel > gzip.BestCompression {
+		return nil, fmt.Errorf("invalid gzip_level: %d, expected 1 to 9", config.GzipLevel)
+	}
+
+	// The sites are completed on a copy, leaving the caller's map untouched
+	sites := make(map[string]SiteConfig, len(config.Sites))
+	for name, siteConfig := range config.Sites {
+		siteConfig.Name = name
+		siteConfig.location = time.UTC
+		if siteConfig.DefaultTimezone != "" {
+			var err error
+			siteConfig.location, err = time.LoadLocation(siteConfig.DefaultTimezone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid default_timezone for site %s: %v", name, err)
+			}
+		}
+		if siteConfig.DateAttribute == "" {
+			siteConfig.DateAttribute = "datetime"
+		}
+		if siteConfig.DetectLanguage {
+			var err error
+			if siteConfig.languages, err = languageOptions(siteConfig.DetectLanguages, name); err != nil {
+				return nil, err
+			}
+		}
+		if siteConfig.XSLTURL == "" {
+			siteConfig.XSLTURL = config.XSLTURL
+		}
+		if siteConfig.LinkAttributeName == "" {
+			siteConfig.LinkAttributeName = "href"
+		}
+		if siteConfig.DateParseMode != "" && siteConfig.DateParseMode != dateParseRelative {
+			return nil, fmt.Errorf("invalid date_parse_mode for site %s: %q", name, siteConfig.DateParseMode)
+		}
+		if siteConfig.MaxItemsMode != "" && siteConfig.MaxItemsMode != maxItemsDocument && siteConfig.MaxItemsMode != maxItemsNewest {
+			return nil, fmt.Errorf("invalid max_items_mode for site %s: %q", name, siteConfig.MaxItemsMode)
+		}
+		if siteConfig.UserAgentRotation != "" && siteConfig.UserAgentRotation != userAgentRoundRobin && siteConfig.UserAgentRotation != userAgentRandom {
+			return nil, fmt.Errorf("invalid user_agent_rotation for site %s: %q", name, siteConfig.UserAgentRotation)
+		}
+		if siteConfig.TieBreaker != "" && siteConfig.TieBreaker != tieBreakerDocument && siteConfig.TieBreaker != tieBreakerLink {
+			return nil, fmt.Errorf("invalid tie_breaker for site %s: %q", name, siteConfig.TieBreaker)
+		}
+		if siteConfig.DedupHash != "" && siteConfig.DedupHash != dedupTitleLink && siteConfig.DedupHash != dedupTitleContent {
+			return nil, fmt.Errorf("invalid dedup_hash for site %s: %q", name, siteConfig.DedupHash)
+		}
+		if siteConfig.DedupContentChars <= 0 {
+			siteConfig.DedupContentChars = defaultDedupContentChars
+		}
+		if siteConfig.MissingDates != "" && siteConfig.MissingDates != missingDatesDocumentOrder {
+			return nil, fmt.Errorf("invalid missing_dates for site %s: %q", name, siteConfig.MissingDates)
+		}
+		if siteConfig.MergeExistingRSS && (siteConfig.ExistingRSSURL == "" || len(siteConfig.ArticleSelector) == 0) {
+			return nil, fmt.Errorf("merge_existing_rss for site %s requires existing_rss_url and article_selector", name)
+		}
+		if siteConfig.JSONAPI != nil && siteConfig.JSONAPI.URL == "" {
+			return nil, fmt.Errorf("json_api for site %s has no url", name)
+		}
+		compiled, err := compileSelectors(siteConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selectors for site %s: %v", name, err)
+		}
+		siteConfig.matchers = compiled
+		if err := validateItemAttributes(siteConfig); err != nil {
+			return nil, fmt.Errorf("invalid item_attributes for site %s: %v", name, err)
+		}
+		if siteConfig.ChecksumElement != "" {
+			if err := validateElement(siteConfig.ChecksumElement, siteConfig); err != nil {
+				return nil, fmt.Errorf("invalid checksum_element for site %s: %v", name, err)
+			}
+		}
+		if siteConfig.FullContentFetches < 0 {
+			return nil, fmt.Errorf("invalid full_content_fetches for site %s: %d", name, siteConfig.FullContentFetches)
+		}
+		if siteConfig.PageSize < 0 {
+			return nil, fmt.Errorf("invalid page_size for site %s: %d", name, siteConfig.PageSize)
+		}
+		if siteConfig.ProxyImages {
+			if config.BaseURL == "" {
+				return nil, fmt.Errorf("proxy_images for site %s requires base_url", name)
+			}
+			siteConfig.imageProxy = imageProxyURL(config.BaseURL)
+		}
+		if siteConfig.TrackClicks {
+			if config.BaseURL == "" {
+				return nil, fmt.Errorf("track_clicks for site %s requires base_url", name)
+			}
+			siteConfig.clickURL = clickURL(config.BaseURL, name)
+		}
+		if siteConfig.Auth != nil {
+			// Resolved on a copy, leaving the caller's config untouched
+			auth := *siteConfig.Auth
+			if err := auth.resolve(); err != nil {
+				return nil, fmt.Errorf("invalid auth for site %s: %v", name, err)
+			}
+			siteConfig.Auth = &auth
+		}
+		sites[name] = siteConfig
+	}
+	config.Sites = sites
+
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	rt := &Router{config: config, client: client}
+	if rt.client == nil {
+		rt.client = newClient(nil, false, config.FetchTimeout)
+	}
+	rt.cache = newPageCache()
+	rt.enclosureHeads.byURL = make(map[string]feeds.Enclosure)
+	rt.lastGoodFeeds.bySite = make(map[string]*Feed)
+	rt.limiters.byHost = make(map[string]*rate.Limiter)
+	rt.lastFetches.bySite = make(map[string]time.Time)
+	rt.stats.bySite = make(map[string]*statsRing)
+	rt.userAgents.next = make(map[string]int)
+	rt.sitemaps.byURL = make(map[string]sitemapEntry)
+	rt.files.modTimes = make(map[string]time.Time)
+	rt.upstream.validators = make(map[string]upstreamValidators)
+	rt.upstream.served = make(map[string]servedFeed)
+
+	if err := rt.setupSiteClients(); err != nil {
+		return nil, fmt.Errorf("failed to configure site clients: %v", err)
+	}
+	return rt, nil
+}
+
+// Handler returns the HTTP handler serving the feed, metrics, cache and
+// health endpoints
+func (rt *Router) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate_rss", gzipHandler(rt.generateRSS, rt.config.GzipLevel))
+	mux.HandleFunc("/image", rt.imageHandler)
+	mux.HandleFunc("/click", rt.clickHandler)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/opml", rt.opmlHandler)
+	mux.HandleFunc("/stats", rt.statsHandler)
+	mux.HandleFunc("/cache/invalidate", rt.invalidateCacheHandler)
+	mux.HandleFunc("/invalidate", rt.invalidateHandler)
+	mux.HandleFunc("/debug", rt.debugHandler)
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", rt.readyzHandler)
+	return mux
+}
+
+// fetchURLContent returns the content of url, from the cache when possible.
+// Concurrent requests for an uncached URL wait for a single upstream fetch.
+func (rt *Router) fetchURLContent(ctx context.Context, site, url string, budget *retryBudget) ([]byte, error) {
+	key := cacheKey(url)
+	if entry, ok := rt.cache.get(key); ok {
+		cacheRequests.WithLabelValues(site, "hit").Inc()
+		recordFetch(ctx, url, 0, true)
+		return entry.content, nil
+	}
+	cacheRequests.WithLabelValues(site, "miss").Inc()
+
+	if content, ok := rt.withinFetchInterval(site, key); ok {
+		recordFetch(ctx, url, 0, true)
+		return content, nil
+	}
+	entry, err := rt.cache.load(ctx, key, site, func() ([]byte, string, error) {
+		content, err := rt.fetchWithRetry(ctx, site, url, budget)
+		return content, "", err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry.content, nil
+}
+
+// fetchWithRetry fetches url, retrying failures as the site's retry policy
+// and the request's retry budget allow
+func (rt *Router) fetchWithRetry(ctx context.Context, site, url string, budget *retryBudget) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		content, failure, err := rt.fetchOnce(ctx, site, url)
+		if err == nil {
+			return content, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		maxRetries, backoff := rt.retryPolicy(site, failure)
+		if failure == failurePermanent || attempt >= maxRetries || !budget.take() {
+			upstreamErrors.WithLabelValues(site).Inc()
+			return nil, err
+		}
+
+		backoff <<= attempt
+		slog.Warn("Retrying fetch", "site", site, "url", url, "backoff", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fetchedAt returns when the cached content of url was fetched, or the
+// current time if it is not cached
+func (rt *Router) fetchedAt(url string) time.Time {
+	if entry, ok := rt.cache.lookup(cacheKey(url)); ok {
+		return entry.fetched
+	}
+	return time.Now()
+}
+
+// fetchOnce performs a single request for url, reporting what kind of
+// failure occurred so the caller can decide whether to retry
+func (rt *Router) fetchOnce(ctx context.Context, site, url string) ([]byte, failureKind, error) {
+	if isFileURL(url) {
+		return rt.fetchFile(ctx, site, url)
+	}
+	if err := rt.waitForFetchInterval(ctx, site); err != nil {
+		return nil, failurePermanent, err
+	}
+	rt.warmUp(ctx, site, url)
+	if err := rt.waitForRateLimit(ctx, url); err != nil {
+		return nil, failurePermanent, err
+	}
+
+	slog.Debug("Fetching URL", "site", site, "url", url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, failurePermanent, fmt.Errorf("invalid URL: %v", err)
+	}
+	setAuth(req, rt.config.Sites[site])
+	rt.setUserAgent(req, site)
+	rt.setConditional(req, site, url)
+
+	start := time.Now()
+	resp, err := rt.clientFor(site).Do(req)
+	if err != nil {
+		return nil, failureNetwork, fmt.Errorf("failed to fetch the URL: %v", err)
+	}
+	defer resp.Body.Close()
+	recordFetch(ctx, url, resp.StatusCode, false)
+
+	if resp.StatusCode == http.StatusNotModified {
+		// Only conditional requests are answered with 304, and they are only
+		// made while a cached copy is left
+		entry, ok := rt.cache.lookup(cacheKey(url))
+		if !ok {
+			return nil, failurePermanent, fmt.Errorf("server returned %s without a cached copy", resp.Status)
+		}
+		slog.Debug("Upstream unchanged", "site", site, "url", url)
+		return entry.content, failurePermanent, nil
+	}
+
+	// Challenge pages are often served with 403 or 503, so the body of an
+	// error response is read too when the site looks for them
+	siteConfig := rt.config.Sites[site]
+	detectChallenge := siteConfig.ChallengeSelector != "" || siteConfig.ChallengeText != ""
+	if resp.StatusCode >= http.StatusInternalServerError && !detectChallenge {
+		return nil, failureServer, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, failureNetwork, fmt.Errorf("failed to read response body: %v", err)
+	}
+	content = htmlToUTF8(content, resp.Header.Get("Content-Type"))
+	if detectChallenge && matchesPage(content, siteConfig, siteConfig.ChallengeSelector, siteConfig.ChallengeText) {
+		return nil, failurePermanent, fmt.Errorf("server returned a bot challenge page (%s) for %s, the site may need other user_agents or a browser to render it", resp.Status, url)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, failureServer, fmt.Errorf("server returned %s", resp.Status)
+	}
+	// A hard 404 or 410 fails like the site's soft "not found" page does
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, failurePermanent, fmt.Errorf("server returned %s for %s", resp.Status, url)
+	}
+	rt.recordValidators(site, url, resp.Header)
+	if rt.isSoft404(site, content) {
+		return nil, failurePermanent, fmt.Errorf("server returned a \"not found\" page for %s", url)
+	}
+
+	elapsed := time.Since(start)
+	fetchDuration.WithLabelValues(site).Observe(elapsed.Seconds())
+	slog.Debug("Fetched URL", "site", site, "url", url, "duration", elapsed)
+
+	return content, failurePermanent, nil
+}
+
+// isSoft404 reports whether content is the site's "not found" page served
+// with a success status. Such pages fail the fetch, so they are not cached.
+func (rt *Router) isSoft404(site string, content []byte) bool {
+	siteConfig := rt.config.Sites[site]
+	return matchesPage(content, siteConfig, siteConfig.Soft404Selector, siteConfig.Soft404Text)
+}
+
+// matchesPage reports whether content contains text or an element matching
+// selector, whichever is set
+func matchesPage(content []byte, siteConfig SiteConfig, selector, text string) bool {
+	if text != "" && bytes.Contains(content, []byte(text)) {
+		return true
+	}
+	if selector != "" {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+		return err == nil && siteConfig.matchers.find(doc.Selection, selector).Length() > 0
+	}
+	return false
+}
+
+// parseTime parses dateStr in loc unless the date names its own zone, and
+// returns the result in UTC so all items are expressed consistently
+func parseTime(dateStr, format string, loc *time.Location) time.Time {
+	t, err := time.ParseInLocation(format, dateStr, loc)
+	if err != nil {
+		slog.Warn("Error parsing time, using current time instead", "error", err)
+		return time.Now().UTC()
+	}
+	return t.UTC()
+}
+
+// parseDate parses an article date according to the site's date settings.
+// Relative dates are resolved against fetched, the time the page was fetched.
+func parseDate(dateStr string, siteConfig SiteConfig, fetched time.Time) time.Time {
+	if siteConfig.DateParseMode == dateParseRelative {
+		if t, ok := parseRelativeTime(dateStr, fetched.In(siteConfig.location)); ok {
+			return t.UTC()
+		}
+		if siteConfig.DateFormat == "" {
+			slog.Warn("Error parsing relative time, using fetch time instead", "site", siteConfig.Name, "date", dateStr)
+			return fetched.UTC()
+		}
+	}
+	return parseTime(dateStr, siteConfig.DateFormat, siteConfig.location)
+}
+
+func (rt *Router) parseArticle(ctx context.Context, article *goquery.Selection, siteConfig SiteConfig, fetched time.Time) *Item {
+	hasTitle := hasText
+	if siteConfig.AttributeFallback {
+		hasTitle = func(s *goquery.Selection) bool {
+			return hasText(s) || attributeText(s) != ""
+		}
+	}
+	titleTag := siteConfig.TitleSelector.find(article, siteConfig, "title", hasTitle)
+	title := titleTag.Text()
+	if siteConfig.JoinTitleText {
+		title = joinedText(titleTag)
+	}
+	if siteConfig.AttributeFallback && strings.TrimSpace(title) == "" {
+		title = attributeText(titleTag)
+	}
+
+	linkTag := siteConfig.LinkSelector.find(article, siteConfig, "link", func(s *goquery.Selection) bool {
+		return strings.TrimSpace(s.AttrOr(siteConfig.LinkAttributeName, "")) != ""
+	})
+	if siteConfig.ReplaceGenericTitles && isGenericTitle(title, siteConfig) {
+		title = replaceGenericTitle(title, article, titleTag, linkTag, siteConfig)
+	}
+	link, _ := linkTag.Attr(siteConfig.LinkAttributeName)
+	if strings.HasPrefix(link, "?") {
+		// Query-only links keep the page's path and replace only its query
+		link = absoluteURL(siteConfig.URL, link)
+	} else if !strings.HasPrefix(link, "http") {
+		link = siteConfig.URL + link
+	}
+	link = itemLink(link, siteConfig)
+
+	dateTag := siteConfig.DateSelector.find(article, siteConfig, "date", func(s *goquery.Selection) bool {
+		return strings.TrimSpace(s.AttrOr(siteConfig.DateAttribute, "")) != "" || hasText(s)
+	})
+	publishedDate := strings.TrimSpace(dateTag.AttrOr(siteConfig.DateAttribute, ""))
+	if publishedDate == "" {
+		publishedDate = strings.TrimSpace(dateTag.Text())
+	}
+
+	contentTag := siteConfig.ContentSelector.find(article, siteConfig, "content", hasHTML)
+
+	// The thumbnail is read before contentHTML replaces the <picture> elements
+	var image string
+	if siteConfig.PictureSource != "" {
+		if picture := article.Find("picture").First(); picture.Length() > 0 {
+			image = pictureImage(picture, siteConfig)
+		}
+		if siteConfig.HTTPSImages {
+			image = upgradeHTTPS(image)
+		}
+		image = proxyImage(image, siteConfig)
+	}
+
+	description := contentHTML(contentTag, siteConfig)
+	// Content without text but with media is kept, the media being the content
+	if siteConfig.AttributeFallback && !hasText(contentTag) && contentTag.Find("img, picture, video, audio, iframe").Length() == 0 {
+		description = html.EscapeString(attributeText(contentTag))
+	}
+	description += galleryHTML(article, contentTag, siteConfig)
+	if description == "" {
+		description = "No description available"
+	}
+	description = wrapHTML(description)
+
+	// Undated sites get their dates from the document order in buildFeed, and
+	// undated articles from the sitemap or the file in scrapeItems
+	var created time.Time
+	if siteConfig.MissingDates != missingDatesDocumentOrder && !((siteConfig.SitemapDates || siteConfig.FileDates) && publishedDate == "") {
+		created = parseDate(publishedDate, siteConfig, fetched)
+	}
+
+	var categories []string
+	if siteConfig.CategorySelector != "" {
+		siteConfig.matchers.find(article, siteConfig.CategorySelector).Each(func(i int, s *goquery.Selection) {
+			category := strings.TrimSpace(s.Text())
+			if category != "" {
+				categories = append(categories, category)
+			}
+		})
+	}
+
+	var comments string
+	if siteConfig.CommentsSelector != "" {
+		if href, ok := siteConfig.matchers.find(article, siteConfig.CommentsSelector).Attr("href"); ok && strings.TrimSpace(href) != "" {
+			comments = absoluteURL(siteConfig.URL, strings.TrimSpace(href))
+		}
+	}
+
+	guid := articleGUID(article, link, siteConfig)
+	isPermaLink := ""
+	if guid != link {
+		// Only the link itself is known to lead to the article
+		isPermaLink = "false"
+	}
+
+	item := &Item{
+		Item: &feeds.Item{
+			Title:       title,
+			Link:        &feeds.Link{Href: link},
+			Description: description,
+			Created:     created,
+			Id:          guid,
+			IsPermaLink: isPermaLink,
+			Enclosure:   rt.parseEnclosure(ctx, article, siteConfig),
+		},
+		Categories: categories,
+		Comments:   comments,
+		Image:      image,
+		Elements:   itemAttributes(article, siteConfig),
+	}
+	if author := findAuthor(article, siteConfig, false); author != "" {
+		item.Author = &feeds.Author{Name: author}
+	}
+	if siteConfig.UseJSONLD {
+		if ld, ok := findJSONLD(article); ok {
+			applyJSONLD(item, ld, siteConfig)
+		}
+	}
+	return item
+}
+
+// articleGUID returns a stable identifier for an article: the configured GUID
+// element or attribute when present, otherwise the link as linkGUID keeps it
+func articleGUID(article *goquery.Selection, link string, siteConfig SiteConfig) string {
+	if siteConfig.GUIDSelector != "" || siteConfig.GUIDAttr != "" {
+		guidTag := article
+		if siteConfig.GUIDSelector != "" && siteConfig.GUIDSelector != selfSelector {
+			guidTag = siteConfig.matchers.find(article, siteConfig.GUIDSelector).First()
+		}
+
+		var guid string
+		if siteConfig.GUIDAttr != "" {
+			guid = guidTag.AttrOr(siteConfig.GUIDAttr, "")
+		} else {
+			guid = guidTag.Text()
+		}
+		if guid = strings.TrimSpace(guid); guid != "" {
+			return guid
+		}
+	}
+	return linkGUID(link, siteConfig)
+}
+
+// contentHTML returns the HTML of contentTag with internal links and image
+// sources made absolute
+func contentHTML(contentTag *goquery.Selection, siteConfig SiteConfig) string {
+	if siteConfig.TruncateAt != "" {
+		truncateAt(contentTag, siteConfig)
+	}
+	if siteConfig.PictureSource != "" {
+		flattenPictures(contentTag, siteConfig)
+	}
+
+	// Convert internal links to absolute URLs
+	contentTag.Find("a").Each(func(i int, s *goquery.Selection) {
+		href, exists := s.Attr("href")
+		if exists && strings.HasPrefix(href, "/") {
+			s.SetAttr("href", siteConfig.URL+href)
+		}
+	})
+
+	// Convert internal image sources to absolute URLs
+	contentTag.Find("img").Each(func(i int, s *goquery.Selection) {
+		src, exists := s.Attr("src")
+		if exists && strings.HasPrefix(src, "/") {
+			s.SetAttr("src", siteConfig.URL+src)
+		}
+	})
+
+	if siteConfig.HTTPSImages {
+		contentTag.Find("img, source").Each(func(i int, s *goquery.Selection) {
+			if src, exists := s.Attr("src"); exists {
+				s.SetAttr("src", upgradeHTTPS(src))
+			}
+			if srcset, exists := s.Attr("srcset"); exists {
+				s.SetAttr("srcset", strings.ReplaceAll(srcset, "http://", "https://"))
+			}
+		})
+	}
+
+	if siteConfig.imageProxy != "" {
+		contentTag.Find("img").Each(func(i int, s *goquery.Selection) {
+			src, exists := s.Attr("src")
+			if !exists {
+				return
+			}
+			if proxied := proxyImage(src, siteConfig); proxied != src {
+				s.SetAttr("src", proxied)
+				// The candidates would bypass the proxy, and fail like the original src
+				s.RemoveAttr("srcset")
+			}
+		})
+	}
+
+	if len(siteConfig.IframeAllowlist) > 0 {
+		filterIframes(contentTag, siteConfig)
+	}
+
+	if siteConfig.StripUnsafeAttributes {
+		stripUnsafeAttributes(contentTag)
+	}
+
+	// Get the HTML content
+	content, _ := contentTag.Html()
+	return content
+}
+
+// wrapHTML wraps the HTML content with a comment indicating it's HTML
+func wrapHTML(content string) string {
+	return fmt.Sprintf("<!-- HTML content start -->\n%s\n<!-- HTML content end -->", content)
+}
+
+// galleryHTML collects the images matched by the gallery selector as <img>
+// tags, skipping images already present in the content
+func galleryHTML(article, contentTag *goquery.Selection, siteConfig SiteConfig) string {
+	if siteConfig.GallerySelector == "" {
+		return ""
+	}
+	attr := siteConfig.GalleryAttribute
+	if attr == "" {
+		attr = "src"
+	}
+
+	seen := make(map[string]bool)
+	contentTag.Find("img").Each(func(i int, s *goquery.Selection) {
+		if src, exists := s.Attr("src"); exists {
+			seen[src] = true
+		}
+	})
+
+	var gallery strings.Builder
+	siteConfig.matchers.find(article, siteConfig.GallerySelector).Each(func(i int, s *goquery.Selection) {
+		src := strings.TrimSpace(s.AttrOr(attr, ""))
+		if src == "" {
+			return
+		}
+		if !strings.HasPrefix(src, "http") {
+			src = siteConfig.URL + src
+		}
+		if siteConfig.HTTPSImages {
+			src = upgradeHTTPS(src)
+		}
+		src = proxyImage(src, siteConfig)
+		if seen[src] {
+			return
+		}
+		seen[src] = true
+		fmt.Fprintf(&gallery, "\n<img src=\"%s\"/>", html.EscapeString(src))
+	})
+	return gallery.String()
+}
+
+// parseEnclosure builds the media enclosure of an article, or returns nil
+// when the site has no enclosure selector or the article has no media
+func (rt *Router) parseEnclosure(ctx context.Context, article *goquery.Selection, siteConfig SiteConfig) *feeds.Enclosure {
+	if siteConfig.EnclosureSelector == "" {
+		return nil
+	}
+	media := siteConfig.matchers.find(article, siteConfig.EnclosureSelector).First()
+
+	var src string
+	if siteConfig.EnclosureAttr != "" {
+		src = media.AttrOr(siteConfig.EnclosureAttr, "")
+	} else {
+		src = media.AttrOr("src", media.AttrOr("href", ""))
+	}
+	if src == "" {
+		return nil
+	}
+	if !strings.HasPrefix(src, "http") {
+		src = siteConfig.URL + src
+	}
+
+	enclosure := &feeds.Enclosure{Url: src, Type: siteConfig.EnclosureType}
+	if siteConfig.EnclosureLength != "" {
+		enclosure.Length = media.AttrOr(siteConfig.EnclosureLength, "")
+	}
+	if enclosure.Type == "" {
+		enclosure.Type = media.AttrOr("type", "")
+	}
+
+	if siteConfig.EnclosureHead && (enclosure.Length == "" || enclosure.Type == "") {
+		length, contentType, err := rt.headEnclosure(ctx, siteConfig.Name, src)
+		if err != nil {
+			slog.Warn("Error reading enclosure size", "site", siteConfig.Name, "url", src, "error", err)
+		}
+		if enclosure.Length == "" {
+			enclosure.Length = length
+		}
+		if enclosure.Type == "" {
+			enclosure.Type = contentType
+		}
+	}
+
+	if enclosure.Type == "" {
+		enclosure.Type = mime.TypeByExtension(path.Ext(strings.SplitN(src, "?", 2)[0]))
+	}
+	if enclosure.Type == "" {
+		enclosure.Type = "application/octet-stream"
+	}
+	// RSS requires a length, 0 is the customary value when it is unknown
+	if enclosure.Length == "" {
+		enclosure.Length = "0"
+	}
+	return enclosure
+}
+
+// headEnclosure reads the size and type of a media file without downloading
+// it. Results are remembered, as published media rarely changes.
+func (rt *Router) headEnclosure(ctx context.Context, site, url string) (string, string, error) {
+	rt.enclosureHeads.Lock()
+	head, ok := rt.enclosureHeads.byURL[url]
+	rt.enclosureHeads.Unlock()
+	if ok {
+		return head.Length, head.Type, nil
+	}
+
+	if err := rt.waitForRateLimit(ctx, url); err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid URL: %v", err)
+	}
+	setAuth(req, rt.config.Sites[site])
+	rt.setUserAgent(req, site)
+
+	resp, err := rt.clientFor(site).Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch the URL: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("server returned %s for %s", resp.Status, url)
+	}
+
+	var length string
+	if resp.ContentLength >= 0 {
+		length = strconv.FormatInt(resp.ContentLength, 10)
+	}
+	contentType := resp.Header.Get("Content-Type")
+
+	rt.enclosureHeads.Lock()
+	rt.enclosureHeads.byURL[url] = feeds.Enclosure{Url: url, Length: length, Type: contentType}
+	rt.enclosureHeads.Unlock()
+
+	return length, contentType, nil
+}
+
+// isPassthrough reports whether the site's existing feed is served unchanged.
+// full_content_selector implies parse_existing_rss, as enriching the items
+// needs them parsed.
+func isPassthrough(siteConfig SiteConfig) bool {
+	return siteConfig.ExistingRSSURL != "" && !siteConfig.ParseExistingRSS && siteConfig.FullContentSelector == "" && !siteConfig.MergeExistingRSS && siteConfig.JSONAPI == nil
+}
+
+// buildSiteFeed builds the feed of a site whose feed is not passed through,
+// from whichever source the site is configured with
+func (rt *Router) buildSiteFeed(ctx context.Context, siteConfig SiteConfig, budget *retryBudget) (*Feed, error) {
+	switch {
+	case siteConfig.JSONAPI != nil:
+		return rt.buildFeedFromJSON(ctx, siteConfig, budget)
+	case siteConfig.MergeExistingRSS:
+		return rt.buildMergedFeed(ctx, siteConfig, budget)
+	case siteConfig.ExistingRSSURL != "":
+		return rt.buildFeedFromRSS(ctx, siteConfig, budget)
+	default:
+		return rt.buildFeed(ctx, siteConfig, budget)
+	}
+}
+
+func (rt *Router) generateRSS(w http.ResponseWriter, r *http.Request) {
+	siteName := r.URL.Query().Get("site")
+	siteConfig, ok := rt.config.Sites[siteName]
+	if !ok {
+		http.Error(w, "Site not found in configuration", http.StatusNotFound)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatRSS
+	}
+	if format != formatRSS && format != formatJSON {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+	page := feedPage{size: siteConfig.PageSize, format: format, baseURL: rt.publicURL(r)}
+	var err error
+	if page.number, err = parsePage(r.URL.Query().Get("page")); err != nil {
+		http.Error(w, "Invalid page", http.StatusBadRequest)
+		return
+	}
+	perPage, err := parsePerPage(r.URL.Query().Get("per_page"))
+	if err != nil {
+		http.Error(w, "Invalid per_page", http.StatusBadRequest)
+		return
+	}
+	if perPage > 0 {
+		page.size, page.perPage = perPage, true
+	}
+	passthrough := isPassthrough(siteConfig)
+	if passthrough && format == formatJSON {
+		http.Error(w, "JSON Feed is not available for sites whose feed is passed through", http.StatusBadRequest)
+		return
+	}
+
+	slog.Debug("RSS generation started", "site", siteName)
+	start := time.Now()
+	// Upstream fetches are aborted as soon as the client goes away
+	ctx := r.Context()
+	budget := newRetryBudget(rt.config.RetryBudget)
+
+	// Pages of per_page requests are not tracked, as clients choose their size freely
+	variant := feedVariant(siteName, page)
+	conditional := siteConfig.ConditionalUpstream && !page.perPage
+	if conditional && r.Header.Get("If-None-Match") != "" {
+		if etag, ok := rt.unchangedFeed(ctx, siteConfig, variant, budget); ok && notModified(r, etag, time.Time{}) {
+			setValidators(w, etag, time.Time{})
+			w.WriteHeader(http.StatusNotModified)
+			rssGenerations.WithLabelValues(siteName, "not_modified").Inc()
+			slog.Debug("Sources unchanged, feed not rebuilt", "site", siteName)
+			return
+		}
+	}
+
+	var rss string
+	var feed *Feed
+	stream := false
+
+	if passthrough {
+		rss, err = rt.fetchExistingRSS(ctx, siteName, siteConfig.ExistingRSSURL, budget)
+	} else {
+		feed, err = rt.buildSiteFeed(ctx, siteConfig, budget)
+		if err == nil && siteConfig.TrackClicks {
+			trackClicks(feed, siteConfig)
+		}
+		if err == nil {
+			// Recorded before min_items can substitute an older feed, so a stall shows
+			rt.recordGeneration(siteName, feed)
+		}
+		if err == nil && siteConfig.MinItems > 0 {
+			feed, err = rt.checkMinItems(feed, siteConfig)
+		}
+		if err == nil && page.size > 0 {
+			var ok bool
+			if feed, ok = paginateFeed(feed, siteName, page); !ok {
+				http.Error(w, "Page not found", http.StatusNotFound)
+				return
+			}
+		}
+		if err == nil {
+			// Validation needs the complete document, so validated feeds are always buffered
+			stream = rt.config.StreamThreshold > 0 && len(feed.Items) > rt.config.StreamThreshold && rt.config.FeedValidation == "" && format == formatRSS
+			switch {
+			case format == formatJSON:
+				rss, err = renderJSONFeed(feed)
+			case !stream:
+				rss, err = renderRSS(feed)
+			}
+		}
+		if err == nil && rt.config.FeedValidation != "" && format == formatRSS {
+			if verr := validateRSS([]byte(rss)); verr != nil {
+				if rt.config.FeedValidation == validationFail {
+					err = fmt.Errorf("generated feed is invalid: %v", verr)
+				} else {
+					slog.Warn("Generated feed is invalid", "site", siteName, "error", verr)
+				}
+			}
+		}
+	}
+
+	if err != nil && ctx.Err() != nil {
+		rssGenerations.WithLabelValues(siteName, "cancelled").Inc()
+		slog.Info("RSS generation cancelled", "site", siteName, "duration", time.Since(start), "reason", ctx.Err())
+		return
+	}
+	if err != nil {
+		rssGenerations.WithLabelValues(siteName, "error").Inc()
+		slog.Error("Error generating RSS", "site", siteName, "error", err)
+		http.Error(w, "Failed to generate RSS", http.StatusInternalServerError)
+		return
+	}
+
+	var etag string
+	var lastModified time.Time
+	if !stream {
+		etag = feedETag([]byte(rss))
+		if conditional {
+			rt.recordServed(ctx, siteConfig, variant, etag, budget)
+		}
+	}
+	if feed != nil {
+		lastModified = feed.newestItemTime()
+	}
+	setValidators(w, etag, lastModified)
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		rssGenerations.WithLabelValues(siteName, "not_modified").Inc()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	extension := ".xml"
+	if format == formatJSON {
+		w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+		extension = ".json"
+	}
+	if r.URL.Query().Get("download") == "1" {
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": siteName + extension})
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	if stream {
+		// Large feeds are encoded straight into the response instead of being buffered first
+		if err := writeRSS(w, feed); err != nil {
+			slog.Error("Error streaming RSS", "site", siteName, "error", err)
+		}
+	} else {
+		w.Write([]byte(rss))
+	}
+
+	elapsed := time.Since(start)
+	rssGenerations.WithLabelValues(siteName, "success").Inc()
+	generationDuration.WithLabelValues(siteName).Observe(elapsed.Seconds())
+	if feed != nil {
+		slog.Info("RSS generation completed", "site", siteName, "duration", elapsed, "items", len(feed.Items))
+	} else {
+		slog.Info("RSS generation completed", "site", siteName, "duration", elapsed)
+	}
+}
+
+// invalidateCache removes every cached URL for which match returns true and
+// reports how many entries were dropped
+func (rt *Router) invalidateCache(match func(url, site string) bool) int {
+	return rt.cache.invalidate(match)
+}
+
+// authorized checks the request's bearer token against the configured admin token
+func (rt *Router) authorized(r *http.Request) bool {
+	if rt.config.AdminToken == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(rt.config.AdminToken)) == 1
+}
+
+func (rt *Router) invalidateCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !rt.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	var removed int
+	switch {
+	case query.Get("site") != "":
+		siteName := query.Get("site")
+		siteConfig, ok := rt.config.Sites[siteName]
+		if !ok {
+			http.Error(w, "Site not found in configuration", http.StatusNotFound)
+			return
+		}
+		removed = rt.invalidateCache(siteCacheMatch(siteName, siteConfig))
+	case query.Get("url") != "":
+		target := cacheKey(query.Get("url"))
+		removed = rt.invalidateCache(func(url, site string) bool { return url == target })
+	default:
+		removed = rt.invalidateCache(func(url, site string) bool { return true })
+	}
+
+	slog.Info("Invalidated cache entries", "count", removed, "query", r.URL.RawQuery)
+	fmt.Fprintf(w, "Invalidated %d cache entries\n", removed)
+}
+
+// siteCacheMatch matches the cached URLs fetched for a site, along with its
+// page and feed when they were cached by another site sharing them
+func siteCacheMatch(siteName string, siteConfig SiteConfig) func(url, site string) bool {
+	return func(url, site string) bool {
+		return site == siteName || url == cacheKey(siteConfig.URL) || url == cacheKey(siteConfig.ExistingRSSURL)
+	}
+}
+
+// invalidateHandler lets a CMS announce new content: it drops the cached
+// pages of the site given in the form or JSON body, or of all sites for
+// "all", together with the last feed kept for min_items, so the next request
+// rebuilds the feed from fresh pages
+func (rt *Router) invalidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !rt.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var siteName string
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var body struct {
+			Site string `json:"site"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		siteName = body.Site
+	} else {
+		siteName = r.FormValue("site")
+	}
+
+	var removed int
+	switch siteName {
+	case "":
+		http.Error(w, "Missing site", http.StatusBadRequest)
+		return
+	case "all":
+		removed = rt.invalidateCache(func(url, site string) bool { return true })
+		rt.lastGoodFeeds.Lock()
+		clear(rt.lastGoodFeeds.bySite)
+		rt.lastGoodFeeds.Unlock()
+	default:
+		siteConfig, ok := rt.config.Sites[siteName]
+		if !ok {
+			http.Error(w, "Site not found in configuration", http.StatusNotFound)
+			return
+		}
+		removed = rt.invalidateCache(siteCacheMatch(siteName, siteConfig))
+		rt.lastGoodFeeds.Lock()
+		delete(rt.lastGoodFeeds.bySite, siteName)
+		rt.lastGoodFeeds.Unlock()
+	}
+
+	slog.Info("Invalidated site by webhook", "site", siteName, "count", removed)
+	fmt.Fprintf(w, "Invalidated %d cache entries\n", removed)
+}
+
+func (rt *Router) fetchExistingRSS(ctx context.Context, site, url string, budget *retryBudget) (string, error) {
+	content, err := rt.fetchURLContent(ctx, site, url, budget)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch existing RSS: %v", err)
+	}
+	return string(content), nil
+}
+
+func (rt *Router) buildFeed(ctx context.Context, siteConfig SiteConfig, budget *retryBudget) (*Feed, error) {
+	items, doc, err := rt.scrapeItems(ctx, siteConfig, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	description := siteConfig.Description
+	if description == "" {
+		description = pageDescription(doc)
+	}
+	feed := rt.newFeed(ctx, siteConfig.Title, siteConfig.URL, description, items, siteConfig, budget)
+	discoverIcons(feed, doc, siteConfig)
+	return feed, nil
+}
+
+// scrapeItems fetches the site's page and parses its articles, returning the
+// page too for the channel metadata it declares
+func (rt *Router) scrapeItems(ctx context.Context, siteConfig SiteConfig, budget *retryBudget) ([]*Item, *goquery.Document, error) {
+	content, err := rt.fetchURLContent(ctx, siteConfig.Name, siteConfig.URL, budget)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch the URL: %v", err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	articles := siteConfig.ArticleSelector.find(doc.Selection, siteConfig, "article", func(s *goquery.Selection) bool {
+		return s.Length() > 0
+	})
+	slog.Debug("Found articles", "site", siteConfig.Name, "count", articles.Length())
+
+	fetched := rt.fetchedAt(siteConfig.URL)
+	var items []*Item
+	articles.Each(func(i int, s *goquery.Selection) {
+		items = append(items, rt.parseArticle(ctx, s, siteConfig, fetched))
+	})
+	if siteConfig.SitemapDates {
+		rt.sitemapDates(ctx, items, siteConfig)
+	}
+	if siteConfig.FileDates {
+		rt.fileDates(items, siteConfig)
+	}
+	if siteConfig.MissingDates == missingDatesDocumentOrder {
+		documentOrderDates(items, fetched)
+	} else if siteConfig.SitemapDates || siteConfig.FileDates {
+		for _, item := range items {
+			if item.Created.IsZero() {
+				item.Created = time.Now().UTC()
+			}
+		}
+	}
+	return items, doc, nil
+}
+
+// documentOrderDates dates the items that have no date of their own
+// descending from the fetch time, one second apart, so the first item on the
+// page is the newest
+func documentOrderDates(items []*Item, fetched time.Time) {
+	for i, item := range items {
+		if item.Created.IsZero() {
+			item.Created = fetched.Add(-time.Duration(i) * time.Second).UTC()
+		}
+	}
+}
+
+// newFeed deduplicates and limits items according to the site's settings,
+// fetches their full content when configured and wraps them in a feed
+func (rt *Router) newFeed(ctx context.Context, title, link, description string, items []*Item, siteConfig SiteConfig, budget *retryBudget) *Feed {
+	items = dedupItems(items, siteConfig)
+	items = limitItems(items, siteConfig)
+	if siteConfig.CanonicalGUID {
+		// Only the pages of the items kept are fetched; items they reveal to
+		// be the same article are merged afterwards
+		rt.canonicalGUIDs(ctx, items, siteConfig, budget)
+		items = dedupItems(items, siteConfig)
+	}
+	feedItems.WithLabelValues(siteConfig.Name).Observe(float64(len(items)))
+
+	if siteConfig.FullContentSelector != "" {
+		rt.fetchFullContent(ctx, items, siteConfig, budget)
+	}
+	if siteConfig.DetectLanguage {
+		detectLanguages(items, siteConfig)
+	}
+	if siteConfig.ChecksumElement != "" {
+		addChecksums(items, siteConfig)
+	}
+
+	feed := &Feed{
+		Feed: &feeds.Feed{
+			Title:       title,
+			Link:        &feeds.Link{Href: link},
+			Description: description,
+		},
+		Items:      items,
+		Namespaces: siteConfig.Namespaces,
+		Icon:       siteConfig.Icon,
+		Favicon:    siteConfig.Favicon,
+		Stylesheet: siteConfig.XSLTURL,
+	}
+	// The channel date follows the content rather than the request time, so
+	// unchanged feeds serialize identically and keep their ETag
+	feed.Created = feed.newestItemTime()
+	if feed.Created.IsZero() {
+		feed.Created = time.Now()
+	}
+	return feed
+}
+
+// checkMinItems guards against layout changes that silently break the
+// article selector. A feed with fewer than min_items items is replaced by the
+// last one that had enough, or turned into an error when there is none.
+func (rt *Router) checkMinItems(feed *Feed, siteConfig SiteConfig) (*Feed, error) {
+	rt.lastGoodFeeds.Lock()
+	defer rt.lastGoodFeeds.Unlock()
+
+	if len(feed.Items) >= siteConfig.MinItems {
+		rt.lastGoodFeeds.bySite[siteConfig.Name] = feed
+		return feed, nil
+	}
+
+	slog.Warn("Too few items found, the article selector may be broken",
+		"site", siteConfig.Name, "url", siteConfig.URL, "selector", siteConfig.ArticleSelector,
+		"items", len(feed.Items), "min_items", siteConfig.MinItems)
+	if last, ok := rt.lastGoodFeeds.bySite[siteConfig.Name]; ok {
+		slog.Info("Serving the last successfully generated feed", "site", siteConfig.Name)
+		return last, nil
+	}
+	return nil, fmt.Errorf("found %d items, fewer than min_items %d", len(feed.Items), siteConfig.MinItems)
+}
+
+// dedupItems drops items whose GUID already appeared earlier in the feed,
+// or with dedup_hash set, whose content hash did
+func dedupItems(items []*Item, siteConfig SiteConfig) []*Item {
+	seen := make(map[string]bool)
+	seenHashes := make(map[string]bool)
+	unique := items[:0]
+	for _, item := range items {
+		if seen[item.Id] {
+			continue
+		}
+		if siteConfig.DedupHash != "" {
+			hash := contentHash(item, siteConfig)
+			if seenHashes[hash] {
+				slog.Debug("Dropping duplicate item", "site", siteConfig.Name, "link", item.Link.Href)
+				continue
+			}
+			seenHashes[hash] = true
+		}
+		seen[item.Id] = true
+		unique = append(unique, item)
+	}
+	return unique
+}
+
+// limitItems applies max_items. In "newest" mode the items are sorted by
+// date first, so the most recent ones are kept whatever the page order.
+func limitItems(items []*Item, siteConfig SiteConfig) []*Item {
+	if siteConfig.MaxItemsMode == maxItemsNewest {
+		sortNewestFirst(items, siteConfig)
+	}
+	if siteConfig.MaxItems > 0 && len(items) > siteConfig.MaxItems {
+		items = items[:siteConfig.MaxItems]
+	}
+	return items
+}
+
+// sortNewestFirst orders items by date, most recent first. Items with the
+// same date, common with date-only formats, keep their order in the source,
+// or are ordered by link with tie_breaker: link, for sites that shuffle them
+// between fetches.
+func sortNewestFirst(items []*Item, siteConfig SiteConfig) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].Created.Equal(items[j].Created) {
+			return items[i].Created.After(items[j].Created)
+		}
+		if siteConfig.TieBreaker == tieBreakerLink && items[i].Link != nil && items[j].Link != nil {
+			return items[i].Link.Href < items[j].Link.Href
+		}
+		return false
+	})
+}
+
+// pageDescription reads the description a page declares in its meta tags
+func pageDescription(doc *goquery.Document) string {
+	for _, selector := range []string{`meta[name="description"]`, `meta[property="og:description"]`} {
+		if content := strings.TrimSpace(doc.Find(selector).AttrOr("content", "")); content != "" {
+			return content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,447 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gorilla/feeds"
+)
+
+// testRouter returns a router for a single site named "test", completed by
+// New as a configured site would be, along with that site's settings
+func testRouter(t testing.TB, siteConfig SiteConfig, client *http.Client) (*Router, SiteConfig) {
+	t.Helper()
+	rt, err := New(Config{Sites: map[string]SiteConfig{"test": siteConfig}}, client)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return rt, rt.config.Sites["test"]
+}
+
+// selection parses html and returns the first element matching selector
+func selection(t *testing.T, html, selector string) *goquery.Selection {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("parsing HTML: %v", err)
+	}
+	sel := doc.Find(selector).First()
+	if sel.Length() == 0 {
+		t.Fatalf("no element matches %q", selector)
+	}
+	return sel
+}
+
+func TestArticleGUID(t *testing.T) {
+	tests := []struct {
+		name       string
+		article    string
+		link       string
+		siteConfig SiteConfig
+		want       string
+	}{
+		{
+			name:    "link by default",
+			article: `<article><a href="/news.php?id=1">One</a></article>`,
+			link:    "https://example.com/news.php?id=1",
+			want:    "https://example.com/news.php?id=1",
+		},
+		{
+			name:       "query stripped when opted in",
+			article:    `<article><a href="/post?utm_source=x">One</a></article>`,
+			link:       "https://example.com/post?utm_source=x#top",
+			siteConfig: SiteConfig{GUIDStripQuery: true},
+			want:       "https://example.com/post",
+		},
+		{
+			name:       "attribute of the article",
+			article:    `<article data-id="p42"><a href="/post?id=42">One</a></article>`,
+			link:       "https://example.com/post?id=42",
+			siteConfig: SiteConfig{GUIDAttr: "data-id"},
+			want:       "p42",
+		},
+		{
+			name:       "text of a selected element",
+			article:    `<article><span class="id"> 42 </span></article>`,
+			link:       "https://example.com/post",
+			siteConfig: SiteConfig{GUIDSelector: "span.id"},
+			want:       "42",
+		},
+		{
+			name:       "missing GUID element falls back to the query-less link",
+			article:    `<article><a href="/post?ref=home">One</a></article>`,
+			link:       "https://example.com/post?ref=home",
+			siteConfig: SiteConfig{GUIDSelector: "span.id"},
+			want:       "https://example.com/post",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := articleGUID(selection(t, tt.article, "article"), tt.link, tt.siteConfig)
+			if got != tt.want {
+				t.Errorf("articleGUID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupItems(t *testing.T) {
+	item := func(id, title string) *Item {
+		return &Item{Item: &feeds.Item{Id: id, Title: title, Link: &feeds.Link{Href: id}}}
+	}
+	tests := []struct {
+		name       string
+		items      []*Item
+		siteConfig SiteConfig
+		want       []string
+	}{
+		{
+			name:  "articles told apart by a query parameter",
+			items: []*Item{item("https://example.com/news.php?id=1", "One"), item("https://example.com/news.php?id=2", "Two")},
+			want:  []string{"One", "Two"},
+		},
+		{
+			name:  "repeated GUID keeps the first item",
+			items: []*Item{item("https://example.com/a", "First"), item("https://example.com/b", "Other"), item("https://example.com/a", "Again")},
+			want:  []string{"First", "Other"},
+		},
+		{
+			name:       "same title and link under different GUIDs",
+			items:      []*Item{item("https://example.com/a", "Same"), item("https://example.com/a#2", "Same")},
+			siteConfig: SiteConfig{DedupHash: dedupTitleLink},
+			want:       []string{"Same"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, item := range dedupItems(tt.items, tt.siteConfig) {
+				got = append(got, item.Title)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("dedupItems() kept %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	tests := []struct {
+		name   string
+		date   string
+		format string
+		loc    *time.Location
+		want   time.Time
+	}{
+		{"zone-less date in UTC", "2024-05-01 10:00", "2006-01-02 15:04", time.UTC, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{"zone-less date in the site's zone", "2024-05-01 10:00", "2006-01-02 15:04", berlin, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)},
+		{"date naming its own zone", "2024-05-01T10:00:00+09:00", time.RFC3339, berlin, time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseTime(tt.date, tt.format, tt.loc)
+			if !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("parseTime(%q) = %v, want %v in UTC", tt.date, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("unparseable date", func(t *testing.T) {
+		before := time.Now()
+		got := parseTime("not a date", "2006-01-02", time.UTC)
+		if got.Before(before.Add(-time.Second)) || got.After(time.Now().Add(time.Second)) {
+			t.Errorf("parseTime() = %v, want the current time", got)
+		}
+	})
+}
+
+func TestParseDate(t *testing.T) {
+	fetched := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		date       string
+		siteConfig SiteConfig
+		want       time.Time
+	}{
+		{
+			name:       "date_format",
+			date:       "2024-05-01",
+			siteConfig: SiteConfig{DateFormat: "2006-01-02"},
+			want:       time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "relative date against the fetch time",
+			date:       "2 hours ago",
+			siteConfig: SiteConfig{DateParseMode: dateParseRelative},
+			want:       time.Date(2024, 5, 15, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			name:       "absolute date in relative mode",
+			date:       "2024-05-01",
+			siteConfig: SiteConfig{DateParseMode: dateParseRelative, DateFormat: "2006-01-02"},
+			want:       time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "unparseable date in relative mode",
+			date:       "soon",
+			siteConfig: SiteConfig{DateParseMode: dateParseRelative},
+			want:       fetched,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.siteConfig.location = time.UTC
+			if got := parseDate(tt.date, tt.siteConfig, fetched); !got.Equal(tt.want) {
+				t.Errorf("parseDate(%q) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArticle(t *testing.T) {
+	fetched := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	base := SiteConfig{
+		URL:             "https://example.com",
+		TitleSelector:   Selectors{"h2"},
+		LinkSelector:    Selectors{"h2 a"},
+		DateSelector:    Selectors{"time"},
+		ContentSelector: Selectors{"div.content"},
+		DateFormat:      "2006-01-02",
+	}
+	tests := []struct {
+		name        string
+		article     string
+		configure   func(*SiteConfig)
+		wantTitle   string
+		wantLink    string
+		wantGUID    string
+		wantCreated time.Time
+		wantContent string
+	}{
+		{
+			name:        "relative link and datetime attribute",
+			article:     `<article><h2><a href="/posts/one">First post</a></h2><time datetime="2024-05-01">May 1</time><div class="content"><p>Hello <a href="/about">about</a></p></div></article>`,
+			wantTitle:   "First post",
+			wantLink:    "https://example.com/posts/one",
+			wantGUID:    "https://example.com/posts/one",
+			wantCreated: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			wantContent: `<a href="https://example.com/about">about</a>`,
+		},
+		{
+			name:        "tracking parameters stripped",
+			article:     `<article><h2><a href="https://example.com/two?utm_source=feed&id=2">Second</a></h2><time>2024-05-02</time><div class="content">Text</div></article>`,
+			configure:   func(c *SiteConfig) { c.StripQueryParams = []string{"utm_*"} },
+			wantTitle:   "Second",
+			wantLink:    "https://example.com/two?id=2",
+			wantGUID:    "https://example.com/two?id=2",
+			wantCreated: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+			wantContent: "Text",
+		},
+		{
+			name:    "fallback selector",
+			article: `<article><h3><a href="https://example.com/three">Third</a></h3><time>2024-05-03</time><div class="content">Text</div></article>`,
+			configure: func(c *SiteConfig) {
+				c.TitleSelector = Selectors{"h2", "h3"}
+				c.LinkSelector = Selectors{"h2 a", "h3 a"}
+			},
+			wantTitle:   "Third",
+			wantLink:    "https://example.com/three",
+			wantGUID:    "https://example.com/three",
+			wantCreated: time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC),
+			wantContent: "Text",
+		},
+		{
+			name:        "GUID attribute",
+			article:     `<article data-id="42"><h2><a href="https://example.com/four">Fourth</a></h2><time>2024-05-04</time><div class="content">Text</div></article>`,
+			configure:   func(c *SiteConfig) { c.GUIDAttr = "data-id" },
+			wantTitle:   "Fourth",
+			wantLink:    "https://example.com/four",
+			wantGUID:    "42",
+			wantCreated: time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC),
+			wantContent: "Text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			siteConfig := base
+			if tt.configure != nil {
+				tt.configure(&siteConfig)
+			}
+			rt, siteConfig := testRouter(t, siteConfig, nil)
+			item := rt.parseArticle(context.Background(), selection(t, tt.article, "article"), siteConfig, fetched)
+
+			if item.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", item.Title, tt.wantTitle)
+			}
+			if item.Link.Href != tt.wantLink {
+				t.Errorf("link = %q, want %q", item.Link.Href, tt.wantLink)
+			}
+			if item.Id != tt.wantGUID {
+				t.Errorf("GUID = %q, want %q", item.Id, tt.wantGUID)
+			}
+			if !item.Created.Equal(tt.wantCreated) {
+				t.Errorf("created = %v, want %v", item.Created, tt.wantCreated)
+			}
+			if !strings.Contains(item.Description, tt.wantContent) {
+				t.Errorf("description = %q, want it to contain %q", item.Description, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestBuildFeed(t *testing.T) {
+	base := SiteConfig{
+		Title:           "Test",
+		TitleSelector:   Selectors{"h2"},
+		LinkSelector:    Selectors{"h2 a"},
+		DateSelector:    Selectors{"time"},
+		ContentSelector: Selectors{"p"},
+		ArticleSelector: Selectors{"article"},
+		DateFormat:      "2006-01-02",
+	}
+	tests := []struct {
+		name      string
+		status    int
+		page      string
+		configure func(*SiteConfig)
+		wantLinks []string // Relative to the server URL
+		wantErr   bool
+	}{
+		{
+			name: "articles in page order",
+			page: `<html><head><meta name="description" content="Listing"></head><body>
+				<article><h2><a href="/one">One</a></h2><time>2024-05-01</time><p>First</p></article>
+				<article><h2><a href="/two">Two</a></h2><time>2024-05-02</time><p>Second</p></article>
+				</body></html>`,
+			wantLinks: []string{"/one", "/two"},
+		},
+		{
+			name: "articles told apart by a query parameter",
+			page: `<html><body>
+				<article><h2><a href="/news.php?id=1">One</a></h2><time>2024-05-01</time><p>First</p></article>
+				<article><h2><a href="/news.php?id=2">Two</a></h2><time>2024-05-02</time><p>Second</p></article>
+				</body></html>`,
+			wantLinks: []string{"/news.php?id=1", "/news.php?id=2"},
+		},
+		{
+			name: "query-only links on one listing",
+			page: `<html><body>
+				<article><h2><a href="?page=2">Page 2</a></h2><time>2024-05-01</time><p>Second page</p></article>
+				<article><h2><a href="?page=3">Page 3</a></h2><time>2024-05-02</time><p>Third page</p></article>
+				</body></html>`,
+			configure: func(c *SiteConfig) { c.URL += "/list?page=1" },
+			wantLinks: []string{"/list?page=2", "/list?page=3"},
+		},
+		{
+			name: "max_items keeps the newest",
+			page: `<html><body>
+				<article><h2><a href="/old">Old</a></h2><time>2024-01-01</time><p>Old</p></article>
+				<article><h2><a href="/new">New</a></h2><time>2024-05-01</time><p>New</p></article>
+				</body></html>`,
+			configure: func(c *SiteConfig) { c.MaxItems = 1; c.MaxItemsMode = maxItemsNewest },
+			wantLinks: []string{"/new"},
+		},
+		{
+			name:      "soft 404",
+			page:      `<html><body><h1>Page not found</h1></body></html>`,
+			configure: func(c *SiteConfig) { c.Soft404Text = "Page not found" },
+			wantErr:   true,
+		},
+		{
+			name:    "not found",
+			status:  http.StatusNotFound,
+			page:    `<html><body><article><h2><a href="/one">One</a></h2></article></body></html>`,
+			wantErr: true,
+		},
+		{
+			name:    "gone",
+			status:  http.StatusGone,
+			page:    `<html><body>Gone</body></html>`,
+			wantErr: true,
+		},
+		{
+			name:    "server error",
+			status:  http.StatusServiceUnavailable,
+			page:    `<html><body>Unavailable</body></html>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write([]byte(tt.page))
+			}))
+			defer srv.Close()
+
+			siteConfig := base
+			siteConfig.URL = srv.URL
+			if tt.configure != nil {
+				tt.configure(&siteConfig)
+			}
+			rt, siteConfig := testRouter(t, siteConfig, srv.Client())
+			feed, err := rt.buildFeed(context.Background(), siteConfig, newRetryBudget(rt.config.RetryBudget))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("buildFeed() succeeded with %d items, want an error", len(feed.Items))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildFeed() error = %v", err)
+			}
+
+			var links []string
+			for _, item := range feed.Items {
+				links = append(links, strings.TrimPrefix(item.Link.Href, srv.URL))
+			}
+			if strings.Join(links, " ") != strings.Join(tt.wantLinks, " ") {
+				t.Errorf("item links = %q, want %q", links, tt.wantLinks)
+			}
+			if feed.Title != "Test" {
+				t.Errorf("feed title = %q, want %q", feed.Title, "Test")
+			}
+		})
+	}
+}
+
+func TestGenerateRSSUpstreamNotFound(t *testing.T) {
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	rt, _ := testRouter(t, SiteConfig{
+		URL:             srv.URL,
+		Title:           "Test",
+		TitleSelector:   Selectors{"h2"},
+		LinkSelector:    Selectors{"h2 a"},
+		ArticleSelector: Selectors{"article"},
+	}, srv.Client())
+	for i := 1; i <= 2; i++ {
+		rec := httptest.NewRecorder()
+		rt.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/generate_rss?site=test", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("request %d: status = %d, want %d", i, rec.Code, http.StatusInternalServerError)
+		}
+	}
+	// The 404 is not cached, so the second request asks upstream again
+	if got := hits.Load(); got != 2 {
+		t.Errorf("upstream hit %d times, want 2", got)
+	}
+}
@@ -0,0 +1,142 @@
+package router
+
+import (
+	"encoding/xml"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/gorilla/feeds"
+)
+
+// rssDocument mirrors the document produced by feeds.ToXML, but lets the
+// items be encoded one at a time instead of converting them all up front.
+type rssDocument struct {
+	XMLName          xml.Name   `xml:"rss"`
+	Version          string     `xml:"version,attr"`
+	ContentNamespace string     `xml:"xmlns:content,attr"`
+	MediaNamespace   string     `xml:"xmlns:media,attr,omitempty"`
+	AtomNamespace    string     `xml:"xmlns:atom,attr,omitempty"`
+	DCNamespace      string     `xml:"xmlns:dc,attr,omitempty"`
+	Namespaces       []xml.Attr `xml:",any,attr"`
+	Channel          rssChannel
+}
+
+type rssChannel struct {
+	*feeds.RssFeed
+	Links []rssAtomLink `xml:"atom:link"`
+	Items rssItems      `xml:"item"`
+}
+
+const dcNamespace = "http://purl.org/dc/elements/1.1/"
+
+// rssAtomLink links a page of a paginated feed to its neighbours
+type rssAtomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// rssItem extends the library's item with the elements it cannot express
+type rssItem struct {
+	*feeds.RssItem
+	Categories []string      `xml:"category"`
+	Thumbnail  *rssThumbnail `xml:"media:thumbnail"`
+	Language   string        `xml:"dc:language,omitempty"`
+	Elements   []itemElement
+}
+
+type rssThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+// rssItems converts and encodes each item only when it is written
+type rssItems []*Item
+
+func (items rssItems) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	for _, item := range items {
+		if err := e.Encode(newRssItem(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newRssItem converts a single item, using the library's own conversion for
+// the fields it supports
+func newRssItem(item *Item) *rssItem {
+	rss := &feeds.Rss{Feed: &feeds.Feed{Items: []*feeds.Item{item.Item}}}
+	rssItem := &rssItem{
+		RssItem:    rss.RssFeed().Items[0],
+		Categories: item.Categories,
+		Elements:   item.Elements,
+		Language:   item.Language,
+	}
+	rssItem.Comments = item.Comments
+	if item.Image != "" {
+		rssItem.Thumbnail = &rssThumbnail{URL: item.Image}
+	}
+	return rssItem
+}
+
+// writeRSS encodes feed as RSS 2.0 directly into w. The output is written
+// incrementally, so large feeds never exist as a single string in memory.
+func writeRSS(w io.Writer, feed *Feed) error {
+	channel := *feed.Feed
+	channel.Items = nil
+
+	doc := rssDocument{
+		Version:          "2.0",
+		ContentNamespace: "http://purl.org/rss/1.0/modules/content/",
+		Namespaces:       namespaceAttrs(feed.Namespaces),
+		Channel: rssChannel{
+			RssFeed: (&feeds.Rss{Feed: &channel}).RssFeed(),
+			Items:   feed.Items,
+		},
+	}
+
+	if feed.Previous != "" {
+		doc.Channel.Links = append(doc.Channel.Links, rssAtomLink{Rel: "previous", Href: feed.Previous, Type: "application/rss+xml"})
+	}
+	if feed.Next != "" {
+		doc.Channel.Links = append(doc.Channel.Links, rssAtomLink{Rel: "next", Href: feed.Next, Type: "application/rss+xml"})
+	}
+	if len(doc.Channel.Links) > 0 {
+		doc.AtomNamespace = "http://www.w3.org/2005/Atom"
+	}
+
+	for _, item := range feed.Items {
+		if item.Image != "" {
+			doc.MediaNamespace = "http://search.yahoo.com/mrss/"
+			break
+		}
+	}
+	for _, item := range feed.Items {
+		if item.Language != "" {
+			doc.DCNamespace = dcNamespace
+			break
+		}
+	}
+
+	header := xml.Header[:len(xml.Header)-1] + "<!-- Item descriptions contain HTML content -->\n"
+	if feed.Stylesheet != "" {
+		// Browsers apply the stylesheet to show a readable page instead of raw XML
+		header += `<?xml-stylesheet type="text/xsl" href="` + html.EscapeString(feed.Stylesheet) + `"?>` + "\n"
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// renderRSS returns the whole feed as a string, for feeds small enough to buffer
+func renderRSS(feed *Feed) (string, error) {
+	var sb strings.Builder
+	if err := writeRSS(&sb, feed); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
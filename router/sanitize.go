@@ -0,0 +1,103 @@
+package router
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// urlAttributes are the attributes that can carry a javascript: URL
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true,
+	"xlink:href": true, "data": true, "poster": true, "background": true,
+}
+
+// stripUnsafeAttributes removes inline event handlers (on*) and
+// javascript: URLs from sel and all of its descendants
+func stripUnsafeAttributes(sel *goquery.Selection) {
+	sel.Find("*").AddSelection(sel).Each(func(i int, s *goquery.Selection) {
+		for _, node := range s.Nodes {
+			kept := node.Attr[:0]
+			for _, attr := range node.Attr {
+				if !unsafeAttribute(attr) {
+					kept = append(kept, attr)
+				}
+			}
+			node.Attr = kept
+		}
+	})
+}
+
+func unsafeAttribute(attr html.Attribute) bool {
+	key := strings.ToLower(attr.Key)
+	if strings.HasPrefix(key, "on") {
+		return true
+	}
+	if !urlAttributes[key] {
+		return false
+	}
+	// Browsers ignore whitespace and control characters inside the scheme
+	value := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, attr.Val)
+	return strings.HasPrefix(strings.ToLower(value), "javascript:")
+}
+
+// filterIframes keeps the iframes whose source is on an allowed domain or one
+// of its subdomains, with the source made absolute and https, and removes
+// all other iframes
+func filterIframes(sel *goquery.Selection, siteConfig SiteConfig) {
+	sel.Find("iframe").Each(func(i int, s *goquery.Selection) {
+		src := strings.TrimSpace(s.AttrOr("src", ""))
+		if src == "" {
+			s.Remove()
+			return
+		}
+		src = upgradeHTTPS(absoluteURL(siteConfig.URL, src))
+		u, err := url.Parse(src)
+		if err != nil || u.Scheme != "https" || !allowedDomain(u.Hostname(), siteConfig.IframeAllowlist) {
+			s.Remove()
+			return
+		}
+		s.SetAttr("src", src)
+		// srcdoc takes precedence over src and could embed anything
+		s.RemoveAttr("srcdoc")
+	})
+}
+
+// allowedDomain reports whether host is one of domains or a subdomain of one
+func allowedDomain(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateAt cuts the content at the first element matching truncate_at,
+// such as a "Related posts" heading: that element and everything after it
+// are removed, at every level up to the content element, so the remaining
+// HTML stays well formed
+func truncateAt(contentTag *goquery.Selection, siteConfig SiteConfig) {
+	root := contentTag.First()
+	boundary := siteConfig.matchers.find(root, siteConfig.TruncateAt).First()
+	if boundary.Length() == 0 {
+		return
+	}
+	for node := boundary.Get(0); node != nil && node != root.Get(0); node = node.Parent {
+		for sibling := node.NextSibling; sibling != nil; {
+			next := sibling.NextSibling
+			node.Parent.RemoveChild(sibling)
+			sibling = next
+		}
+	}
+	boundary.Remove()
+}
@@ -0,0 +1,156 @@
+package router
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// Selectors is a CSS selector, or a list of selectors tried in order until
+// one yields a non-empty result. A single string keeps its CSS meaning, so
+// "h2, h3" still selects both kinds of element at once.
+type Selectors []string
+
+func (s *Selectors) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var selector string
+	if err := unmarshal(&selector); err == nil {
+		*s = Selectors{selector}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+func (s Selectors) String() string {
+	return strings.Join(s, " | ")
+}
+
+// find returns the matches within sel of the first selector whose result
+// nonEmpty accepts, or the matches of the first selector when none does.
+// Using a fallback is logged, as it hints that the site's markup changed.
+func (s Selectors) find(sel *goquery.Selection, siteConfig SiteConfig, field string, nonEmpty func(*goquery.Selection) bool) *goquery.Selection {
+	var primary *goquery.Selection
+	for i, selector := range s {
+		found := sel
+		// Find only searches descendants, so :self uses the element directly
+		if selector != selfSelector {
+			found = siteConfig.matchers.find(sel, selector)
+		}
+		if nonEmpty(found) {
+			if i > 0 {
+				slog.Debug("Using fallback selector", "site", siteConfig.Name, "field", field, "selector", selector, "primary", s[0])
+			}
+			return found
+		}
+		if primary == nil {
+			primary = found
+		}
+	}
+	if primary == nil {
+		return sel.Find("")
+	}
+	return primary
+}
+
+// hasText reports whether sel contains any non-whitespace text
+func hasText(sel *goquery.Selection) bool {
+	return strings.TrimSpace(sel.Text()) != ""
+}
+
+// hasHTML reports whether sel has any content, text or not
+func hasHTML(sel *goquery.Selection) bool {
+	content, _ := sel.Html()
+	return strings.TrimSpace(content) != ""
+}
+
+// textAttributes are the attributes that describe an element without text
+var textAttributes = []string{"title", "aria-label", "alt"}
+
+// attributeText returns the first non-empty title, aria-label or alt
+// attribute of sel, or else of the elements inside it, for elements that
+// carry their text in an attribute, such as an icon link or a lone image
+func attributeText(sel *goquery.Selection) string {
+	var text string
+	sel.First().AddSelection(sel.First().Find("[title], [aria-label], [alt]")).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		for _, name := range textAttributes {
+			if text = strings.TrimSpace(s.AttrOr(name, "")); text != "" {
+				return false
+			}
+		}
+		return true
+	})
+	return text
+}
+
+// joinedText returns the text of sel with each text node trimmed and the
+// non-empty ones joined by single spaces, so a title split over elements
+// such as <span>Part</span><span>Two</span> reads "Part Two"
+func joinedText(sel *goquery.Selection) string {
+	var words []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			words = append(words, strings.Fields(n.Data)...)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range sel.Nodes {
+		walk(n)
+	}
+	return strings.Join(words, " ")
+}
+
+// matchers holds a site's selectors compiled once at startup, so they are not
+// parsed again for every article of every request
+type matchers map[string]goquery.Matcher
+
+// find returns the descendants of sel matching selector, compiling it on the
+// spot if it was not compiled at startup
+func (m matchers) find(sel *goquery.Selection, selector string) *goquery.Selection {
+	if matcher, ok := m[selector]; ok {
+		return sel.FindMatcher(matcher)
+	}
+	return sel.Find(selector)
+}
+
+// compileSelectors compiles all selectors of a site, reporting the first
+// invalid one rather than letting it silently match nothing
+func compileSelectors(siteConfig SiteConfig) (matchers, error) {
+	var selectors []string
+	for _, list := range []Selectors{siteConfig.ArticleSelector, siteConfig.TitleSelector, siteConfig.LinkSelector, siteConfig.DateSelector, siteConfig.ContentSelector, siteConfig.AuthorSelector} {
+		selectors = append(selectors, list...)
+	}
+	selectors = append(selectors, siteConfig.CategorySelector, siteConfig.CommentsSelector, siteConfig.GUIDSelector,
+		siteConfig.GallerySelector, siteConfig.EnclosureSelector, siteConfig.FullContentSelector, siteConfig.Soft404Selector,
+		siteConfig.ChallengeSelector, siteConfig.TitleFallbackSelector, siteConfig.TruncateAt)
+	if siteConfig.PictureSource != pictureLargest {
+		selectors = append(selectors, siteConfig.PictureSource)
+	}
+
+	m := make(matchers)
+	for _, selector := range selectors {
+		if selector == "" || selector == selfSelector {
+			continue
+		}
+		if _, ok := m[selector]; ok {
+			continue
+		}
+		compiled, err := cascadia.Compile(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", selector, err)
+		}
+		m[selector] = compiled
+	}
+	return m, nil
+}
@@ -0,0 +1,206 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultSitemapTTL = time.Hour
+	// maxSitemapChildren bounds the sitemaps read from a sitemap index; the
+	// most recently modified ones hold the articles a listing shows
+	maxSitemapChildren = 10
+	// sitemapRetryInterval is how long a sitemap that could not be read is
+	// left alone, so an unavailable sitemap does not slow down every request
+	sitemapRetryInterval = time.Minute
+)
+
+// sitemapDateLayouts are the W3C datetime forms used by lastmod
+var sitemapDateLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"}
+
+// sitemapDocument holds a sitemap or a sitemap index, whichever the
+// document is
+type sitemapDocument struct {
+	URLs []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+		// Google News sitemaps give the publication date itself
+		PublicationDate string `xml:"news>publication_date"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"sitemap"`
+}
+
+// sitemapEntry is the parsed dates of a sitemap, kept until expiry
+type sitemapEntry struct {
+	dates  map[string]time.Time
+	expiry time.Time
+}
+
+// sitemapURL returns the site's sitemap_url, or /sitemap.xml on its host
+func sitemapURL(siteConfig SiteConfig) string {
+	if siteConfig.SitemapURL != "" {
+		return siteConfig.SitemapURL
+	}
+	u, err := url.Parse(siteConfig.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/sitemap.xml"
+}
+
+// sitemapKey identifies an article in a sitemap whatever its scheme, as
+// sitemaps often list https URLs of pages linked over http or vice versa
+func sitemapKey(link string) string {
+	key := cacheKey(link)
+	if i := strings.Index(key, "://"); i >= 0 {
+		return key[i+3:]
+	}
+	return key
+}
+
+// sitemapDates dates the items without a date of their own from the site's
+// sitemap, using the news publication date when given and lastmod otherwise
+func (rt *Router) sitemapDates(ctx context.Context, items []*Item, siteConfig SiteConfig) {
+	// Errors are logged by loadSitemap, as reads may happen in the background
+	dates, err := rt.sitemap(ctx, siteConfig)
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		if !item.Created.IsZero() {
+			continue
+		}
+		if date, ok := dates[sitemapKey(item.Link.Href)]; ok {
+			item.Created = date
+		}
+	}
+}
+
+// sitemap returns the dates listed in the site's sitemap by article. Parsed
+// sitemaps are kept for sitemap_ttl, independently of the page cache, as
+// they are large and change less often than the pages they describe. An
+// expired sitemap is still used while it is refreshed in the background, so
+// only the very first lookup waits for the sitemap to be read.
+func (rt *Router) sitemap(ctx context.Context, siteConfig SiteConfig) (map[string]time.Time, error) {
+	sitemapURL := sitemapURL(siteConfig)
+	rt.sitemaps.Lock()
+	entry, ok := rt.sitemaps.byURL[sitemapURL]
+	rt.sitemaps.Unlock()
+	if ok {
+		if !time.Now().Before(entry.expiry) {
+			rt.loadSitemap(siteConfig, sitemapURL)
+		}
+		return entry.dates, nil
+	}
+
+	select {
+	case result := <-rt.loadSitemap(siteConfig, sitemapURL):
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(map[string]time.Time), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// loadSitemap reads a sitemap into the sitemap cache. Concurrent loads of
+// the same sitemap share one read, which is not tied to any request, so a
+// client going away does not waste it for the others. After a failed read,
+// the previous dates, or none, are used for sitemapRetryInterval before the
+// sitemap is tried again.
+func (rt *Router) loadSitemap(siteConfig SiteConfig, sitemapURL string) <-chan singleflight.Result {
+	return rt.sitemaps.inflight.DoChan(sitemapURL, func() (interface{}, error) {
+		timeout := rt.config.FetchTimeout * time.Duration(maxSitemapChildren+1)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		dates, err := rt.readSitemap(ctx, siteConfig, sitemapURL, newRetryBudget(rt.config.RetryBudget))
+		if err != nil {
+			slog.Warn("Error reading sitemap", "site", siteConfig.Name, "url", sitemapURL, "error", err)
+			rt.sitemaps.Lock()
+			entry := rt.sitemaps.byURL[sitemapURL]
+			entry.expiry = time.Now().Add(sitemapRetryInterval)
+			rt.sitemaps.byURL[sitemapURL] = entry
+			rt.sitemaps.Unlock()
+			return nil, err
+		}
+		return dates, nil
+	})
+}
+
+// readSitemap fetches and parses a sitemap, along with the most recent
+// sitemaps it lists when it is a sitemap index
+func (rt *Router) readSitemap(ctx context.Context, siteConfig SiteConfig, sitemapURL string, budget *retryBudget) (map[string]time.Time, error) {
+	doc, err := rt.fetchSitemap(ctx, siteConfig.Name, sitemapURL, budget)
+	if err != nil {
+		return nil, err
+	}
+	dates := make(map[string]time.Time)
+	addSitemapDates(dates, doc)
+
+	// A sitemap index only lists further sitemaps, the newest first here
+	sort.SliceStable(doc.Sitemaps, func(i, j int) bool {
+		return doc.Sitemaps[i].LastMod > doc.Sitemaps[j].LastMod
+	})
+	for i, child := range doc.Sitemaps {
+		if i == maxSitemapChildren {
+			break
+		}
+		childDoc, err := rt.fetchSitemap(ctx, siteConfig.Name, absoluteURL(sitemapURL, strings.TrimSpace(child.Loc)), budget)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			slog.Warn("Error reading sitemap", "site", siteConfig.Name, "url", child.Loc, "error", err)
+			continue
+		}
+		addSitemapDates(dates, childDoc)
+	}
+
+	ttl := siteConfig.SitemapTTL
+	if ttl <= 0 {
+		ttl = defaultSitemapTTL
+	}
+	rt.sitemaps.Lock()
+	rt.sitemaps.byURL[sitemapURL] = sitemapEntry{dates: dates, expiry: time.Now().Add(ttl)}
+	rt.sitemaps.Unlock()
+	slog.Debug("Read sitemap", "site", siteConfig.Name, "url", sitemapURL, "articles", len(dates))
+	return dates, nil
+}
+
+func (rt *Router) fetchSitemap(ctx context.Context, site, sitemapURL string, budget *retryBudget) (*sitemapDocument, error) {
+	content, err := rt.fetchURLContent(ctx, site, sitemapURL, budget)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sitemap: %v", err)
+	}
+	var doc sitemapDocument
+	if err := unmarshalXML(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap: %v", err)
+	}
+	return &doc, nil
+}
+
+func addSitemapDates(dates map[string]time.Time, doc *sitemapDocument) {
+	for _, u := range doc.URLs {
+		date := u.PublicationDate
+		if strings.TrimSpace(date) == "" {
+			date = u.LastMod
+		}
+		for _, layout := range sitemapDateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(date)); err == nil {
+				dates[sitemapKey(strings.TrimSpace(u.Loc))] = t.UTC()
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// defaultStatsHistory is the number of generations kept per site for /stats
+const defaultStatsHistory = 20
+
+// generationStat records one successful feed generation, so changes in a
+// site's update cadence can be spotted from /stats
+type generationStat struct {
+	Time   time.Time `json:"time"`
+	Items  int       `json:"items"`
+	Newest time.Time `json:"newest"` // Date of the newest item
+}
+
+// statsRing keeps the most recent generations of a site, overwriting the
+// oldest once full
+type statsRing struct {
+	entries []generationStat
+	next    int
+}
+
+func (r *statsRing) add(stat generationStat, size int) {
+	if len(r.entries) < size {
+		r.entries = append(r.entries, stat)
+		return
+	}
+	r.entries[r.next] = stat
+	r.next = (r.next + 1) % size
+}
+
+// list returns the generations from oldest to newest
+func (r *statsRing) list() []generationStat {
+	return append(append([]generationStat{}, r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// recordGeneration adds a generated feed to its site's history
+func (rt *Router) recordGeneration(site string, feed *Feed) {
+	rt.stats.Lock()
+	defer rt.stats.Unlock()
+
+	ring, ok := rt.stats.bySite[site]
+	if !ok {
+		ring = &statsRing{}
+		rt.stats.bySite[site] = ring
+	}
+	ring.add(generationStat{Time: time.Now().UTC(), Items: len(feed.Items), Newest: feed.newestItemTime().UTC()}, rt.config.StatsHistory)
+}
+
+// statsHandler returns the recent generations of every site, or of the one
+// named by ?site=, as JSON
+func (rt *Router) statsHandler(w http.ResponseWriter, r *http.Request) {
+	site := r.URL.Query().Get("site")
+	if _, ok := rt.config.Sites[site]; site != "" && !ok {
+		http.Error(w, "Site not found in configuration", http.StatusNotFound)
+		return
+	}
+
+	rt.stats.Lock()
+	stats := make(map[string][]generationStat)
+	for name, ring := range rt.stats.bySite {
+		if site == "" || name == site {
+			stats[name] = ring.list()
+		}
+	}
+	rt.stats.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,49 @@
+package router
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// defaultGenericTitles are link labels that say nothing about the article
+var defaultGenericTitles = []string{"read more", "read more »", "read more...", "continue reading", "more", "read article", "full story"}
+
+// isGenericTitle reports whether title is a bare URL or one of the site's
+// generic labels, compared case-insensitively
+func isGenericTitle(title string, siteConfig SiteConfig) bool {
+	title = strings.ToLower(strings.TrimSpace(title))
+	if title == "" || strings.HasPrefix(title, "http://") || strings.HasPrefix(title, "https://") {
+		return true
+	}
+	generic := defaultGenericTitles
+	if len(siteConfig.GenericTitles) > 0 {
+		generic = siteConfig.GenericTitles
+	}
+	for _, g := range generic {
+		if title == strings.ToLower(strings.TrimSpace(g)) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceGenericTitle looks for a meaningful title when the selected one is
+// generic: the text of title_fallback_selector, then the title or aria-label
+// attribute of the title and link elements. The generic title is kept when
+// none of them is any better.
+func replaceGenericTitle(title string, article, titleTag, linkTag *goquery.Selection, siteConfig SiteConfig) string {
+	var candidates []string
+	if siteConfig.TitleFallbackSelector != "" {
+		candidates = append(candidates, siteConfig.matchers.find(article, siteConfig.TitleFallbackSelector).First().Text())
+	}
+	for _, tag := range []*goquery.Selection{titleTag, linkTag} {
+		candidates = append(candidates, tag.AttrOr("title", ""), tag.AttrOr("aria-label", ""))
+	}
+	for _, candidate := range candidates {
+		if !isGenericTitle(candidate, siteConfig) {
+			return strings.TrimSpace(candidate)
+		}
+	}
+	return title
+}
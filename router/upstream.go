@@ -0,0 +1,129 @@
+package router
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// upstreamValidators are the ETag and Last-Modified of the last complete
+// response for a source URL, sent back so an unchanged source answers 304
+type upstreamValidators struct {
+	etag         string
+	lastModified string
+}
+
+// servedFeed is the feed last served for one variant of a site's feed, with
+// a hash of the source content it was built from
+type servedFeed struct {
+	etag       string
+	sourceHash string
+}
+
+// sourceURLs returns the URLs a site's feed is built from. Article pages
+// fetched for full content are not among them.
+func sourceURLs(siteConfig SiteConfig) []string {
+	switch {
+	case siteConfig.JSONAPI != nil:
+		return []string{siteConfig.JSONAPI.URL}
+	case siteConfig.MergeExistingRSS:
+		return []string{siteConfig.URL, siteConfig.ExistingRSSURL}
+	case siteConfig.ExistingRSSURL != "":
+		return []string{siteConfig.ExistingRSSURL}
+	default:
+		return []string{siteConfig.URL}
+	}
+}
+
+// isConditionalSource reports whether url is a source of a site with
+// conditional_upstream
+func (rt *Router) isConditionalSource(site, url string) bool {
+	siteConfig := rt.config.Sites[site]
+	return siteConfig.ConditionalUpstream && slices.Contains(sourceURLs(siteConfig), url)
+}
+
+// setConditional makes req conditional on the validators of the last
+// response for its URL, as long as a cached copy is left to use on a 304
+func (rt *Router) setConditional(req *http.Request, site, url string) {
+	if !rt.isConditionalSource(site, url) {
+		return
+	}
+	if _, ok := rt.cache.lookup(cacheKey(url)); !ok {
+		return
+	}
+	rt.upstream.Lock()
+	validators := rt.upstream.validators[url]
+	rt.upstream.Unlock()
+	if validators.etag != "" {
+		req.Header.Set("If-None-Match", validators.etag)
+	}
+	if validators.lastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.lastModified)
+	}
+}
+
+// recordValidators keeps the validators of a complete response for a source
+func (rt *Router) recordValidators(site, url string, header http.Header) {
+	if !rt.isConditionalSource(site, url) {
+		return
+	}
+	rt.upstream.Lock()
+	rt.upstream.validators[url] = upstreamValidators{etag: header.Get("ETag"), lastModified: header.Get("Last-Modified")}
+	rt.upstream.Unlock()
+}
+
+// feedVariant identifies the response a feed request gets, as the page and
+// format change the served document and its ETag
+func feedVariant(site string, page feedPage) string {
+	return url.Values{"site": {site}, "page": {strconv.Itoa(page.number)}, "format": {page.format}}.Encode()
+}
+
+// sourceHash hashes the current content of the site's sources, fetching
+// them when they are not cached; an unchanged upstream answers with 304
+func (rt *Router) sourceHash(ctx context.Context, siteConfig SiteConfig, budget *retryBudget) (string, error) {
+	h := sha256.New()
+	for _, source := range sourceURLs(siteConfig) {
+		content, err := rt.fetchURLContent(ctx, siteConfig.Name, source, budget)
+		if err != nil {
+			return "", err
+		}
+		h.Write(content)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// unchangedFeed returns the ETag of the feed last served for variant when the
+// site's sources have not changed since, so a client holding that feed can
+// be answered with 304 without building it again
+func (rt *Router) unchangedFeed(ctx context.Context, siteConfig SiteConfig, variant string, budget *retryBudget) (string, bool) {
+	rt.upstream.Lock()
+	served, ok := rt.upstream.served[variant]
+	rt.upstream.Unlock()
+	if !ok {
+		return "", false
+	}
+	hash, err := rt.sourceHash(ctx, siteConfig, budget)
+	if err != nil {
+		slog.Debug("Could not check the sources, building the feed", "site", siteConfig.Name, "error", err)
+		return "", false
+	}
+	return served.etag, hash == served.sourceHash
+}
+
+// recordServed remembers the ETag of a feed served for variant, along with
+// the hash of the cached sources it was built from
+func (rt *Router) recordServed(ctx context.Context, siteConfig SiteConfig, variant, etag string, budget *retryBudget) {
+	hash, err := rt.sourceHash(ctx, siteConfig, budget)
+	if err != nil {
+		return
+	}
+	rt.upstream.Lock()
+	rt.upstream.served[variant] = servedFeed{etag: etag, sourceHash: hash}
+	rt.upstream.Unlock()
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"net/url"
+	"strings"
+)
+
+// cacheKey normalizes rawURL so that spellings of the same resource share a
+// cache entry: scheme and host are lowercased, query parameters sorted, the
+// fragment dropped and trailing slashes removed from the path.
+func cacheKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode()
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+	if u.Path == "" && u.Host != "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// absoluteURL resolves ref against base, returning ref unchanged when either
+// cannot be parsed
+func absoluteURL(base, ref string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
+
+// stripQuery removes the query string and fragment from rawURL
+func stripQuery(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// linkGUID returns the GUID of an item identified by its link: the link
+// itself, or without its query string and fragment with guid_strip_query,
+// for sites whose links carry per-visit parameters. Sites with guid_selector
+// or guid_attr identify articles by something else than the query, so the
+// link they fall back to is stripped too.
+func linkGUID(link string, siteConfig SiteConfig) string {
+	if siteConfig.GUIDStripQuery || siteConfig.GUIDSelector != "" || siteConfig.GUIDAttr != "" {
+		return stripQuery(link)
+	}
+	return link
+}
+
+// itemLink applies the site's link settings to a resolved item link
+func itemLink(link string, siteConfig SiteConfig) string {
+	link = stripQueryParams(link, siteConfig.StripQueryParams, siteConfig.StripAllQuery)
+	if siteConfig.HTTPSLinks {
+		link = upgradeHTTPS(link)
+	}
+	return link
+}
+
+// upgradeHTTPS rewrites an http:// URL to https://, leaving others unchanged
+func upgradeHTTPS(rawURL string) string {
+	if len(rawURL) > len("http://") && strings.EqualFold(rawURL[:len("http://")], "http://") {
+		return "https://" + rawURL[len("http://"):]
+	}
+	return rawURL
+}
+
+// stripQueryParams removes the query parameters matching names from rawURL,
+// or the whole query when all is set. A name ending in "*" matches every
+// parameter with that prefix, e.g. "utm_*".
+func stripQueryParams(rawURL string, names []string, all bool) string {
+	if !all && len(names) == 0 {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+
+	if all {
+		u.RawQuery = ""
+		return u.String()
+	}
+
+	query := u.Query()
+	removed := false
+	for key := range query {
+		for _, name := range names {
+			if prefix, ok := strings.CutSuffix(name, "*"); ok && strings.HasPrefix(key, prefix) || key == name {
+				delete(query, key)
+				removed = true
+				break
+			}
+		}
+	}
+	if !removed {
+		return rawURL
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,31 @@
+package router
+
+import (
+	"math/rand/v2"
+	"net/http"
+)
+
+const (
+	userAgentRoundRobin = "round_robin"
+	userAgentRandom     = "random"
+)
+
+// setUserAgent sets the User-Agent of req to the next one of the site's
+// user_agents, either taking them in turn or picking one at random. Sites
+// without user_agents keep the client's default.
+func (rt *Router) setUserAgent(req *http.Request, site string) {
+	agents := rt.config.Sites[site].UserAgents
+	if len(agents) == 0 {
+		return
+	}
+	if rt.config.Sites[site].UserAgentRotation == userAgentRandom {
+		req.Header.Set("User-Agent", agents[rand.IntN(len(agents))])
+		return
+	}
+
+	rt.userAgents.Lock()
+	next := rt.userAgents.next[site]
+	rt.userAgents.next[site] = (next + 1) % len(agents)
+	rt.userAgents.Unlock()
+	req.Header.Set("User-Agent", agents[next])
+}
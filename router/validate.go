@@ -0,0 +1,120 @@
+package router
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values of the feed_validation setting
+const (
+	validationLog  = "log"
+	validationFail = "fail"
+)
+
+// validationRSS holds the parts of an RSS 2.0 document that are checked
+type validationRSS struct {
+	XMLName  xml.Name `xml:"rss"`
+	Version  string   `xml:"version,attr"`
+	Channels []struct {
+		Title string `xml:"title"`
+		// Listed before Link, which would otherwise also match <atom:link>
+		AtomLinks   []string `xml:"http://www.w3.org/2005/Atom link"`
+		Link        string   `xml:"link"`
+		Description string   `xml:"description"`
+		PubDate     string   `xml:"pubDate"`
+		Items       []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+			PubDate     string `xml:"pubDate"`
+			Enclosures  []struct {
+				URL    string `xml:"url,attr"`
+				Length string `xml:"length,attr"`
+				Type   string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// validateRSS checks that data is well-formed XML and follows the basic
+// structural rules of RSS 2.0
+func validateRSS(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("malformed XML: %v", err)
+		}
+	}
+
+	var doc validationRSS
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("not an RSS document: %v", err)
+	}
+
+	var problems []string
+	if doc.Version != "2.0" {
+		problems = append(problems, fmt.Sprintf("rss version is %q, expected \"2.0\"", doc.Version))
+	}
+	if len(doc.Channels) != 1 {
+		problems = append(problems, fmt.Sprintf("found %d channels, expected exactly one", len(doc.Channels)))
+	}
+
+	for _, channel := range doc.Channels {
+		if channel.Title == "" {
+			problems = append(problems, "channel has no title")
+		}
+		if channel.Description == "" {
+			problems = append(problems, "channel has no description")
+		}
+		if !isAbsoluteURL(channel.Link) {
+			problems = append(problems, fmt.Sprintf("channel link %q is not an absolute URL", channel.Link))
+		}
+		if channel.PubDate != "" && !isRFC822Date(channel.PubDate) {
+			problems = append(problems, fmt.Sprintf("channel pubDate %q is not an RFC 822 date", channel.PubDate))
+		}
+
+		for i, item := range channel.Items {
+			if item.Title == "" && item.Description == "" {
+				problems = append(problems, fmt.Sprintf("item %d has neither title nor description", i+1))
+			}
+			if item.Link != "" && !isAbsoluteURL(item.Link) {
+				problems = append(problems, fmt.Sprintf("item %d link %q is not an absolute URL", i+1, item.Link))
+			}
+			if item.PubDate != "" && !isRFC822Date(item.PubDate) {
+				problems = append(problems, fmt.Sprintf("item %d pubDate %q is not an RFC 822 date", i+1, item.PubDate))
+			}
+			for _, enclosure := range item.Enclosures {
+				if _, err := strconv.ParseInt(enclosure.Length, 10, 64); err != nil || enclosure.URL == "" || enclosure.Type == "" {
+					problems = append(problems, fmt.Sprintf("item %d enclosure needs url, type and a numeric length", i+1))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func isAbsoluteURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func isRFC822Date(date string) bool {
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC822Z, time.RFC822} {
+		if _, err := time.Parse(layout, date); err == nil {
+			return true
+		}
+	}
+	return false
+}